@@ -0,0 +1,290 @@
+package appsign
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"strings"
+
+	"github.com/gamebtc/appsign/codesign"
+	"github.com/gamebtc/appsign/mach"
+)
+
+// 可能包含嵌套代码的目录
+var nestedCodeDirectories = []string{"Frameworks/", "PlugIns/", "Extensions/", "Watch/"}
+var nestedBundleExtensions = []string{".framework", ".appex", ".app"}
+const dynamicLibraryExtension = ".dylib"
+
+// IPA中的一个bundle(.app/.appex/.framework)
+type Bundle struct {
+	Path      string    // 在IPA中的完整路径，以/结尾
+	Parent    *Bundle
+	Bundles   []*Bundle // 嵌套的bundle
+	Libraries []string  // Frameworks目录下的动态库的完整路径
+}
+
+// 相对于父bundle的路径
+func(b *Bundle)RelativePath()string {
+	if b.Parent == nil {
+		return ""
+	}
+	return strings.TrimSuffix(b.Path[len(b.Parent.Path):], ZipDirectorySeparator)
+}
+
+func isNestedBundleName(name string)bool {
+	for _, ext := range nestedBundleExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// 主bundle及其嵌套的bundle和动态库
+func(f *IpaFile)GetBundle()*Bundle {
+	return f.loadBundle(f.appDirectoryPath, nil)
+}
+
+func(f *IpaFile)loadBundle(path string, parent *Bundle)*Bundle {
+	b := &Bundle{Path: path, Parent: parent}
+	seen := make(map[string]bool)
+	for _, entry := range f.entries {
+		if !strings.HasPrefix(entry.Name, path) {
+			continue
+		}
+		rel := entry.Name[len(path):]
+		for _, dir := range nestedCodeDirectories {
+			if !strings.HasPrefix(rel, dir) {
+				continue
+			}
+			name := rel[len(dir):]
+			if i := strings.Index(name, ZipDirectorySeparator); i > 0 {
+				name = name[:i]
+				if isNestedBundleName(name) && !seen[dir+name] {
+					seen[dir+name] = true
+					b.Bundles = append(b.Bundles, f.loadBundle(path+dir+name+ZipDirectorySeparator, b))
+				}
+			} else if !entry.IsDir && strings.HasSuffix(name, dynamicLibraryExtension) {
+				b.Libraries = append(b.Libraries, entry.Name)
+			}
+		}
+	}
+	return b
+}
+
+// 需要独立描述文件的bundle(扩展和Watch应用)
+func(b *Bundle)IsApplication()bool {
+	name := strings.TrimSuffix(b.Path, ZipDirectorySeparator)
+	return strings.HasSuffix(name, ".app") || strings.HasSuffix(name, ".appex")
+}
+
+// 签名所需的证书和私钥
+type bundleSigner struct {
+	file          *IpaFile
+	certChain     []*x509.Certificate
+	privateKey    crypto.Signer
+	certificateCN string
+	teamID        string
+	options       *ResignOptions
+}
+
+func newBundleSigner(f *IpaFile, certChain []*x509.Certificate, privateKey crypto.Signer, options *ResignOptions)*bundleSigner {
+	s := &bundleSigner{
+		file:       f,
+		certChain:  certChain,
+		privateKey: privateKey,
+		options:    options,
+	}
+	// ad-hoc签名时没有证书
+	if len(certChain) > 0 {
+		signCert := certChain[len(certChain)-1]
+		s.certificateCN = codesign.GetCertificateValue(signCert, codesign.X509CertificateCommonNameOID)
+		s.teamID = codesign.GetCertificateValue(signCert, codesign.X509CertificateOrganizationalUnitOID)
+	}
+	return s
+}
+
+// 查找bundle使用的描述文件，返回nil表示保留bundle中原有的描述文件
+// 保留的描述文件属于其他team时，签名后的扩展无法安装，同样返回没有描述文件的错误
+func(s *bundleSigner)mobileProvisionFor(b *Bundle, bundleId string)(*MobileProvisionFile, error) {
+	if b.Parent == nil {
+		return s.options.MobileProvision, nil
+	}
+	if !b.IsApplication() {
+		return nil, nil
+	}
+	path := strings.TrimSuffix(b.Path[len(s.file.appDirectoryPath):], ZipDirectorySeparator)
+	noProvision := "no mobile provision file for nested bundle " + path + " (" + bundleId + ")"
+	if s.options.BundleProvisions == nil {
+		entry := s.file.getEntry(b.Path + MobileProvisionFileName)
+		if entry == nil || s.teamID == "" {
+			return nil, nil
+		}
+		mobileProvision, err := ParseMobileProvision(entry.Data)
+		if err != nil {
+			return nil, err
+		}
+		if len(mobileProvision.TeamIdentifier) > 0 && mobileProvision.TeamIdentifier[0] != s.teamID {
+			return nil, errors.New(noProvision + ": the embedded profile is for team " +
+				mobileProvision.TeamIdentifier[0] + ", the certificate is for team " + s.teamID)
+		}
+		return nil, nil
+	}
+	if mobileProvision, ok := s.options.BundleProvisions[bundleId]; ok && mobileProvision != nil {
+		return mobileProvision, nil
+	}
+	if mobileProvision, ok := s.options.BundleProvisions[path]; ok && mobileProvision != nil {
+		return mobileProvision, nil
+	}
+	return nil, errors.New(noProvision)
+}
+
+// 自定义的指定要求只用于主bundle的可执行文件，嵌套代码使用默认的要求
+func(s *bundleSigner)signOptions(b *Bundle)*codesign.SignOptions {
+	options := s.options.SignOptions
+	if b == nil || b.Parent != nil {
+		options.DesignatedRequirement = ""
+	}
+	return &options
+}
+
+// 对Mach-O文件的每个架构签名，返回第一个架构的cdhash和指定要求的文本
+func(s *bundleSigner)signMachO(path, ident string, infoFileBytes, codeResBytes []byte, entitlements codesign.EntitlementsFile,
+	options *codesign.SignOptions)([]byte, string, error) {
+	entry := s.file.getEntry(path)
+	if entry == nil {
+		return nil, "", errors.New("not find file: " + path)
+	}
+	files, err := mach.ReadMachObjects(entry.Data)
+	if err != nil {
+		return nil, "", errors.New(path + ": " + err.Error())
+	}
+	var requirement *codesign.Requirement
+	if !options.AdHoc || options.DesignatedRequirement != "" {
+		if requirement, err = codesign.DesignatedRequirement(ident, s.certificateCN, options); err != nil {
+			return nil, "", err
+		}
+	}
+	var cdHash []byte
+	for _, file := range files {
+		hash, err := codesign.ResignExecutable(file, ident, s.certChain, s.privateKey, infoFileBytes, codeResBytes, entitlements, options)
+		if err != nil {
+			return nil, "", errors.New(path + ": " + err.Error())
+		}
+		if cdHash == nil {
+			cdHash = hash
+		}
+	}
+	entry.Data = mach.PackMachObjects(files)
+	if requirement == nil {
+		// ad-hoc签名使用隐含的cdhash要求
+		requirement = codesign.AdHocRequirement(cdHash)
+	}
+	return cdHash, requirement.String(), nil
+}
+
+func(s *bundleSigner)signLibrary(path string)([]byte, string, error) {
+	name := path[strings.LastIndex(path, ZipDirectorySeparator)+1:]
+	ident := strings.TrimSuffix(name, dynamicLibraryExtension)
+	return s.signMachO(path, ident, nil, nil, nil, s.signOptions(nil))
+}
+
+// 嵌套代码的签名结果
+type nestedCode struct {
+	cdHash      []byte
+	requirement string
+}
+
+// 深度优先：先签名嵌套的bundle和动态库，再签名bundle自身
+func(s *bundleSigner)signBundle(b *Bundle)([]byte, string, error) {
+	f := s.file
+	nestedCodes := make(map[string]*nestedCode)
+	for _, nested := range b.Bundles {
+		cdHash, requirement, err := s.signBundle(nested)
+		if err != nil {
+			return nil, "", err
+		}
+		nestedCodes[nested.RelativePath()] = &nestedCode{cdHash, requirement}
+	}
+	for _, lib := range b.Libraries {
+		cdHash, requirement, err := s.signLibrary(lib)
+		if err != nil {
+			return nil, "", err
+		}
+		nestedCodes[lib[len(b.Path):]] = &nestedCode{cdHash, requirement}
+	}
+
+	infoEntry := f.getEntry(b.Path + InfoFileName)
+	if infoEntry == nil {
+		return nil, "", errors.New("not find file: " + b.Path + InfoFileName)
+	}
+	infoFile, err := ParseInfo(infoEntry.Data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var entitlements codesign.EntitlementsFile
+	bundleId := infoFile.BundleId()
+	mobileProvision, err := s.mobileProvisionFor(b, bundleId)
+	if err != nil {
+		return nil, "", err
+	}
+	if mobileProvision != nil {
+		if bundleId, err = mobileProvision.ApplyBundleIdentifier(bundleId); err != nil {
+			return nil, "", err
+		}
+		if infoFile.ReplaceBundleId(bundleId) || b.Parent == nil {
+			if infoEntry.Data, err = infoFile.Marshal(); err != nil {
+				return nil, "", err
+			}
+		}
+		f.replaceEntry(b.Path+MobileProvisionFileName, mobileProvision.raw)
+		entitlements = mobileProvision.Entitlements
+	} else if entry := f.getEntry(b.Path + MobileProvisionFileName); entry != nil {
+		// 嵌套的扩展使用自带的描述文件中的权限
+		mobileProvision, err := ParseMobileProvision(entry.Data)
+		if err != nil {
+			return nil, "", err
+		}
+		entitlements = mobileProvision.Entitlements
+	}
+
+	executableName := infoFile.ExecutableName()
+	codeResBytes, err := f.buildCodeResources(b, executableName, nestedCodes).Marshal()
+	if err != nil {
+		return nil, "", err
+	}
+	f.replaceEntry(b.Path+CodeResourcesFilePath, codeResBytes)
+
+	return s.signMachO(b.Path+executableName, bundleId, infoEntry.Data, codeResBytes, entitlements, s.signOptions(b))
+}
+
+// 根据bundle中的所有文件重新生成CodeResources
+// 嵌套bundle内的文件只记录在files中，嵌套代码在files2中记录cdhash
+func(f *IpaFile)buildCodeResources(b *Bundle, executableName string, nestedCodes map[string]*nestedCode)*codesign.CodeResourcesFile {
+	builder := codesign.NewCodeResourcesBuilder()
+	for _, entry := range f.entries {
+		if entry.IsDir || !strings.HasPrefix(entry.Name, b.Path) {
+			continue
+		}
+		name := entry.Name[len(b.Path):]
+		if name == executableName {
+			continue
+		}
+		inNestedBundle := isInNestedBundle(b, entry.Name)
+		switch {
+		case entry.IsSymlink():
+			if !inNestedBundle {
+				builder.AddSymlink(name, string(entry.Data))
+			}
+		case inNestedBundle:
+			builder.AddLegacyFile(name, entry.Data)
+		default:
+			builder.AddFile(name, entry.Data)
+		}
+	}
+	for name, code := range nestedCodes {
+		builder.AddNestedCode(name, code.cdHash, code.requirement)
+	}
+	return builder.Build()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/gamebtc/appsign/mach"
+)
+
+// 动态库版本 xxxx.yy.zz
+func dylibVersion(version uint32) string {
+	return fmt.Sprintf("%d.%d.%d", version>>16, (version>>8)&0xff, version&0xff)
+}
+
+func dylibCommandName(commandType int) string {
+	switch commandType {
+	case mach.LC_LoadWeakDynamicLibrary:
+		return "weak"
+	case mach.LC_ReexportDynamicLibrary:
+		return "reexport"
+	case mach.LC_LazyLoadDynamicLibrary:
+		return "lazy"
+	case mach.LC_LoadUpwardDynamicLibrary:
+		return "upward"
+	}
+	return "load"
+}
+
+func runDylibs(args []string) int {
+	fs := newFlagSet("dylibs")
+	inPath := fs.String("in", "", "input Mach-O `file`")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	files, err := readMachObjects(*inPath)
+	if err != nil {
+		return fail(exitInvalidInput, "%v", err)
+	}
+	for _, file := range files {
+		fmt.Printf("%s:\n", file.ArchitectureName())
+		if id := file.DylibID(); id != "" {
+			fmt.Printf("  id %s\n", id)
+		}
+		for _, dylib := range file.Dylibs() {
+			fmt.Printf("  %-8s %s (compatibility version %s, current version %s)\n", dylibCommandName(dylib.Type()),
+				dylib.Name, dylibVersion(dylib.CompatibilityVersion), dylibVersion(dylib.CurrentVersion))
+		}
+		for _, path := range file.RunPaths() {
+			fmt.Printf("  rpath    %s\n", path)
+		}
+	}
+	return exitOK
+}
+
+// 修改每个架构的依赖动态库、LC_ID_DYLIB和LC_RPATH，同 install_name_tool
+func runInstallName(args []string) int {
+	fs := newFlagSet("install-name")
+	inPath := fs.String("in", "", "input Mach-O `file`")
+	outPath := fs.String("out", "", "output Mach-O `file` (default: modify the input in place)")
+	var changes, addRunPaths, deleteRunPaths stringsFlag
+	fs.Var(&changes, "change", "change a dependent dylib, `old=new` (repeatable)")
+	id := fs.String("id", "", "set the LC_ID_DYLIB install `name` of a dylib")
+	fs.Var(&addRunPaths, "add-rpath", "add an LC_RPATH `path` (repeatable)")
+	fs.Var(&deleteRunPaths, "delete-rpath", "delete an LC_RPATH `path` (repeatable)")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if len(changes) == 0 && *id == "" && len(addRunPaths) == 0 && len(deleteRunPaths) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	var pairs [][2]string
+	for _, change := range changes {
+		i := strings.Index(change, "=")
+		if i <= 0 || i == len(change)-1 {
+			return fail(exitUsage, "invalid -change %q, expected old=new", change)
+		}
+		pairs = append(pairs, [2]string{change[:i], change[i+1:]})
+	}
+	files, err := readMachObjects(*inPath)
+	if err != nil {
+		return fail(exitInvalidInput, "%v", err)
+	}
+	err = mach.EditMachObjects(files, func(file *mach.MachObjectFile) error {
+		for _, pair := range pairs {
+			if err := file.ChangeDylib(pair[0], pair[1]); err != nil {
+				return err
+			}
+		}
+		if *id != "" {
+			if err := file.SetDylibID(*id); err != nil {
+				return err
+			}
+		}
+		for _, path := range deleteRunPaths {
+			if err := file.DeleteRunPath(path); err != nil {
+				return err
+			}
+		}
+		for _, path := range addRunPaths {
+			if err := file.AddRunPath(path); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fail(exitInvalidInput, "%s: %v", *inPath, err)
+	}
+	for _, file := range files {
+		if file.GetLoadCommand(mach.LC_CodeSignature) != nil {
+			fmt.Fprintf(os.Stderr, "appsign: warning: %s: the code signature is invalidated, sign the file again\n", *inPath)
+			break
+		}
+	}
+	if *outPath == "" {
+		*outPath = *inPath
+	}
+	mode := os.FileMode(0755)
+	if info, err := os.Stat(*inPath); err == nil {
+		mode = info.Mode()
+	}
+	if err := ioutil.WriteFile(*outPath, mach.PackMachObjects(files), mode); err != nil {
+		return fail(exitFailure, "%v", err)
+	}
+	return exitOK
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gamebtc/appsign"
+)
+
+func runInfo(args []string) int {
+	fs := newFlagSet("info")
+	ipaPath := fs.String("ipa", "", "input IPA `file`")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	f, err := loadIpa(*ipaPath)
+	if err != nil {
+		return fail(exitInvalidInput, "%v", err)
+	}
+	infoFile, err := f.GetInfoFile()
+	if err != nil {
+		return fail(exitInvalidInput, "Info.plist: %v", err)
+	}
+	profile, err := f.GetMobileProvision()
+	if err != nil {
+		return fail(exitInvalidInput, "%s: %v", appsign.MobileProvisionFileName, err)
+	}
+
+	printField("Bundle identifier", infoFile.BundleId())
+	printField("Executable", infoFile.ExecutableName())
+	for _, key := range []string{"CFBundleDisplayName", "CFBundleName", "CFBundleShortVersionString", "CFBundleVersion", "MinimumOSVersion"} {
+		if value, ok := infoFile.GetValue(key); ok {
+			printField(key, fmt.Sprint(value))
+		}
+	}
+	printField("Profile name", profile.Name)
+	printField("Profile UUID", profile.UUID)
+	printField("Profile bundle identifier", profile.BundleIdentifier())
+	printField("Team", fmt.Sprintf("%s (%s)", profile.TeamName, strings.Join(profile.TeamIdentifier, ", ")))
+	printField("Profile expires", profile.ExpirationDate.Format(time.RFC3339))
+	printField("Provisioned devices", fmt.Sprint(len(profile.ProvisionedDevices)))
+	return exitOK
+}
+
+func printField(name, value string) {
+	fmt.Printf("%-28s %s\n", name+":", value)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/gamebtc/appsign/mach"
+)
+
+// 可重复的 -in 参数
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// 逗号分隔的列表，忽略空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func readMachObjects(path string) ([]*mach.MachObjectFile, error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing -in")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	files, err := mach.ReadMachObjects(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return files, nil
+}
+
+func writeMachObjects(path string, files []*mach.MachObjectFile) int {
+	if err := ioutil.WriteFile(path, mach.PackMachObjects(files), 0755); err != nil {
+		return fail(exitFailure, "%v", err)
+	}
+	return exitOK
+}
+
+func runArchs(args []string) int {
+	fs := newFlagSet("archs")
+	inPath := fs.String("in", "", "input Mach-O `file`")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	files, err := readMachObjects(*inPath)
+	if err != nil {
+		return fail(exitInvalidInput, "%v", err)
+	}
+	fmt.Println(strings.Join(mach.ArchitectureNames(files), " "))
+	return exitOK
+}
+
+func runThin(args []string) int {
+	fs := newFlagSet("thin")
+	inPath := fs.String("in", "", "input Mach-O `file`")
+	arch := fs.String("arch", "", "`architecture` to extract, e.g. arm64")
+	outPath := fs.String("out", "", "output thin Mach-O `file`")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if *arch == "" || *outPath == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	files, err := readMachObjects(*inPath)
+	if err != nil {
+		return fail(exitInvalidInput, "%v", err)
+	}
+	file, err := mach.ExtractArchitecture(files, *arch)
+	if err != nil {
+		return fail(exitInvalidInput, "%s: %v", *inPath, err)
+	}
+	return writeMachObjects(*outPath, []*mach.MachObjectFile{file})
+}
+
+func runRemoveArch(args []string) int {
+	fs := newFlagSet("remove-arch")
+	inPath := fs.String("in", "", "input Mach-O `file`")
+	archs := fs.String("arch", "", "comma separated `architectures` to remove, e.g. armv7,armv7s")
+	outPath := fs.String("out", "", "output Mach-O `file`")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if *archs == "" || *outPath == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	files, err := readMachObjects(*inPath)
+	if err != nil {
+		return fail(exitInvalidInput, "%v", err)
+	}
+	if files, err = mach.RemoveArchitectures(files, splitList(*archs)...); err != nil {
+		return fail(exitInvalidInput, "%s: %v", *inPath, err)
+	}
+	return writeMachObjects(*outPath, files)
+}
+
+func runMerge(args []string) int {
+	fs := newFlagSet("merge")
+	var inPaths stringsFlag
+	fs.Var(&inPaths, "in", "input Mach-O `file` (repeatable)")
+	outPath := fs.String("out", "", "output universal Mach-O `file`")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if len(inPaths) == 0 || *outPath == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	var inputs [][]*mach.MachObjectFile
+	for _, path := range inPaths {
+		files, err := readMachObjects(path)
+		if err != nil {
+			return fail(exitInvalidInput, "%v", err)
+		}
+		inputs = append(inputs, files)
+	}
+	files, err := mach.MergeMachObjects(inputs...)
+	if err != nil {
+		return fail(exitInvalidInput, "%v", err)
+	}
+	return writeMachObjects(*outPath, files)
+}
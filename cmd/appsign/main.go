@@ -0,0 +1,214 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gamebtc/appsign"
+	"github.com/gamebtc/appsign/codesign"
+)
+
+// 退出码
+const (
+	exitOK           = 0 // 成功
+	exitFailure      = 1 // 签名或写文件失败
+	exitUsage        = 2 // 参数错误
+	exitInvalidInput = 3 // IPA、证书或描述文件无法读取
+	exitVerifyFailed = 4 // 校验未通过
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands = []*command{
+	{"resign", "re-sign an IPA with a .p12 certificate and provisioning profile", runResign},
+	{"info", "print bundle and provisioning information of an IPA", runInfo},
+	{"verify", "check the provisioning profile and code signature of an IPA", runVerify},
+	{"extract-profile", "write the embedded.mobileprovision of an IPA to a file", runExtractProfile},
+	{"entitlements", "print the entitlements of the embedded provisioning profile", runEntitlements},
+	{"archs", "list the architectures of a Mach-O file", runArchs},
+	{"thin", "extract one architecture of a universal Mach-O file", runThin},
+	{"remove-arch", "remove architectures from a universal Mach-O file", runRemoveArch},
+	{"merge", "merge Mach-O files into a universal file", runMerge},
+	{"dylibs", "list the dependent dylibs, install name and rpaths of a Mach-O file", runDylibs},
+	{"install-name", "change dylib install names and rpaths of every architecture", runInstallName},
+	{"sign", "sign a standalone dylib or command-line tool without an IPA", runSign},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: appsign <command> [flags]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun 'appsign <command> -h' for the flags of a command\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+	name := os.Args[1]
+	for _, c := range commands {
+		if c.name == name {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+	if name == "-h" || name == "-help" || name == "help" {
+		usage()
+		os.Exit(exitOK)
+	}
+	fmt.Fprintf(os.Stderr, "appsign: unknown command %q\n", name)
+	usage()
+	os.Exit(exitUsage)
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("appsign "+name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// 解析参数，返回值非负时表示应当以该退出码结束
+func parseFlags(fs *flag.FlagSet, args []string) int {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "%s: unexpected argument %q\n", fs.Name(), fs.Arg(0))
+		return exitUsage
+	}
+	return -1
+}
+
+func fail(code int, format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "appsign: "+format+"\n", args...)
+	return code
+}
+
+func loadIpa(path string) (*appsign.IpaFile, error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing -ipa")
+	}
+	f := new(appsign.IpaFile)
+	if err := f.Load(path); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return f, nil
+}
+
+type passwordFlags struct {
+	password string
+	file     string
+	env      string
+}
+
+func (p *passwordFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&p.password, "password", "", "password of the .p12 file")
+	fs.StringVar(&p.file, "password-file", "", "read the .p12 password from `file`")
+	fs.StringVar(&p.env, "password-env", "", "read the .p12 password from environment `variable`")
+}
+
+// 依次使用 -password、-password-file、-password-env
+func (p *passwordFlags) resolve() (string, error) {
+	if p.password != "" {
+		return p.password, nil
+	}
+	if p.file != "" {
+		data, err := ioutil.ReadFile(p.file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	if p.env != "" {
+		value, ok := os.LookupEnv(p.env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", p.env)
+		}
+		return value, nil
+	}
+	return "", nil
+}
+
+var hashTypeNames = map[string]byte{
+	"sha1":         codesign.HashTypeSHA1,
+	"sha256":       codesign.HashTypeSHA256,
+	"sha256-trunc": codesign.HashTypeSHA256Truncated,
+}
+
+// 解析逗号分隔的CodeDirectory hash类型，如 sha1,sha256
+func parseHashTypes(value string) ([]byte, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var hashTypes []byte
+	for _, name := range strings.Split(value, ",") {
+		hashType, ok := hashTypeNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown digest %q", name)
+		}
+		hashTypes = append(hashTypes, hashType)
+	}
+	return hashTypes, nil
+}
+
+// sign和resign共用的签名参数
+type signFlags struct {
+	digests         string
+	codeSignOptions string
+	requirement     string
+	timestampURL    string
+	timeout         time.Duration
+	adHoc           bool
+}
+
+// target说明 -requirement 作用的代码
+func (s *signFlags) register(fs *flag.FlagSet, target string) {
+	fs.StringVar(&s.digests, "digest", "", "comma separated code directory `digests`: sha1, sha256, sha256-trunc (default sha1,sha256; use sha256 alone for iOS 15+)")
+	fs.StringVar(&s.codeSignOptions, "options", "", "comma separated code signing `flags`: kill, hard, host, expires, restrict, enforcement, library, runtime, or none (default: keep the flags of the existing signature)")
+	fs.StringVar(&s.requirement, "requirement", "", "designated `requirement` "+target+", e.g. 'identifier \"com.example\" and anchor apple generic'")
+	fs.StringVar(&s.timestampURL, "timestamp", "", "RFC 3161 timestamp server `url`, e.g. "+codesign.AppleTimestampURL)
+	fs.DurationVar(&s.timeout, "timestamp-timeout", codesign.DefaultTimestampTimeout, "`timeout` of the timestamp request")
+	fs.BoolVar(&s.adHoc, "adhoc", false, "ad-hoc sign without a certificate, e.g. for jailbroken or TrollStore devices (-p12 is not used)")
+}
+
+// 错误信息以参数名开头
+func (s *signFlags) signOptions() (codesign.SignOptions, error) {
+	options := codesign.SignOptions{AdHoc: s.adHoc, TimestampURL: s.timestampURL, TimestampTimeout: s.timeout}
+	var err error
+	if options.HashTypes, err = parseHashTypes(s.digests); err != nil {
+		return options, fmt.Errorf("-digest: %v", err)
+	}
+	if s.codeSignOptions != "" {
+		flags, err := codesign.ParseCodeSignFlags(s.codeSignOptions)
+		if err != nil {
+			return options, fmt.Errorf("-options: %v", err)
+		}
+		options.Flags = &flags
+	}
+	if s.requirement != "" {
+		if _, err = codesign.CompileRequirement(s.requirement); err != nil {
+			return options, fmt.Errorf("-requirement: %v", err)
+		}
+		options.DesignatedRequirement = s.requirement
+	}
+	return options, nil
+}
+
+func setCertificateStorePath(dir string) {
+	if dir != "" && !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	appsign.CertificateStorePath = dir
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+
+	"howett.net/plist"
+
+	"github.com/gamebtc/appsign"
+)
+
+func runExtractProfile(args []string) int {
+	fs := newFlagSet("extract-profile")
+	ipaPath := fs.String("ipa", "", "input IPA `file`")
+	outPath := fs.String("out", "", "output .mobileprovision `file`")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if *outPath == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	f, err := loadIpa(*ipaPath)
+	if err != nil {
+		return fail(exitInvalidInput, "%v", err)
+	}
+	data, err := f.GetFileBytes(appsign.MobileProvisionFileName)
+	if err != nil {
+		return fail(exitInvalidInput, "%s: %v", appsign.MobileProvisionFileName, err)
+	}
+	if err = ioutil.WriteFile(*outPath, data, 0644); err != nil {
+		return fail(exitFailure, "%v", err)
+	}
+	return exitOK
+}
+
+func runEntitlements(args []string) int {
+	fs := newFlagSet("entitlements")
+	ipaPath := fs.String("ipa", "", "input IPA `file`")
+	profilePath := fs.String("profile", "", "read entitlements from this .mobileprovision instead of an IPA")
+	outPath := fs.String("out", "", "write the entitlements plist to `file` instead of stdout")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	var profile *appsign.MobileProvisionFile
+	var err error
+	if *profilePath != "" {
+		profile, err = appsign.ParseMobileProvisionFromFile(*profilePath)
+	} else {
+		var f *appsign.IpaFile
+		if f, err = loadIpa(*ipaPath); err == nil {
+			profile, err = f.GetMobileProvision()
+		}
+	}
+	if err != nil {
+		return fail(exitInvalidInput, "%v", err)
+	}
+
+	data, err := plist.MarshalIndent(profile.Entitlements, plist.XMLFormat, "\t")
+	if err != nil {
+		return fail(exitFailure, "%v", err)
+	}
+	data = append(data, '\n')
+	if *outPath != "" {
+		err = ioutil.WriteFile(*outPath, data, 0644)
+	} else {
+		_, err = os.Stdout.Write(data)
+	}
+	if err != nil {
+		return fail(exitFailure, "%v", err)
+	}
+	return exitOK
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gamebtc/appsign"
+)
+
+// 可重复的 -bundle-profile key=path 参数
+type bundleProfileFlag map[string]string
+
+func (b bundleProfileFlag) String() string {
+	var items []string
+	for key, path := range b {
+		items = append(items, key+"="+path)
+	}
+	return strings.Join(items, ",")
+}
+
+func (b bundleProfileFlag) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 || i == len(value)-1 {
+		return fmt.Errorf("expected <bundle id or path>=<profile>, got %q", value)
+	}
+	b[value[:i]] = value[i+1:]
+	return nil
+}
+
+func runResign(args []string) int {
+	fs := newFlagSet("resign")
+	ipaPath := fs.String("ipa", "", "input IPA `file`")
+	p12Path := fs.String("p12", "", "signing certificate and private key (.p12)")
+	profilePath := fs.String("profile", "", "provisioning profile (.mobileprovision), defaults to the embedded one")
+	outPath := fs.String("out", "", "output IPA `file`")
+	bundleProfiles := make(bundleProfileFlag)
+	fs.Var(bundleProfiles, "bundle-profile", "provisioning profile for a nested extension as `id=file`, where id is its original bundle id or its path inside the .app (repeatable)")
+	certDir := fs.String("certs", "", "`directory` holding AppleIncRootCertificate.cer and AppleWWDRCA.cer")
+	injectDylib := fs.String("inject-dylib", "", "dylib `file` to copy into Frameworks/ and load from the main executable")
+	weakDylib := fs.Bool("weak", false, "load the injected dylib with LC_LOAD_WEAK_DYLIB")
+	removeArchs := fs.String("remove-arch", "", "comma separated `architectures` to strip from every Mach-O before signing, e.g. armv7,armv7s")
+	allowEncrypted := fs.Bool("allow-encrypted", false, "resign FairPlay encrypted binaries with a warning instead of failing")
+	var sign signFlags
+	sign.register(fs, "of the main executable")
+	var password passwordFlags
+	password.register(fs)
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if (*p12Path == "" && !sign.adHoc) || *outPath == "" {
+		fs.Usage()
+		return exitUsage
+	}
+
+	f, err := loadIpa(*ipaPath)
+	if err != nil {
+		return fail(exitInvalidInput, "%v", err)
+	}
+	var pwd string
+	var certBytes []byte
+	if !sign.adHoc {
+		if pwd, err = password.resolve(); err != nil {
+			return fail(exitInvalidInput, "password: %v", err)
+		}
+		if certBytes, err = ioutil.ReadFile(*p12Path); err != nil {
+			return fail(exitInvalidInput, "%v", err)
+		}
+	}
+	options := new(appsign.ResignOptions)
+	if options.SignOptions, err = sign.signOptions(); err != nil {
+		return fail(exitUsage, "%v", err)
+	}
+	options.AllowEncrypted = *allowEncrypted
+	options.Warn = func(message string) {
+		fmt.Fprintf(os.Stderr, "appsign: warning: %s\n", message)
+	}
+	if *profilePath != "" {
+		if options.MobileProvision, err = appsign.ParseMobileProvisionFromFile(*profilePath); err != nil {
+			return fail(exitInvalidInput, "%s: %v", *profilePath, err)
+		}
+	}
+	if len(bundleProfiles) > 0 {
+		options.BundleProvisions = make(map[string]*appsign.MobileProvisionFile)
+		for key, path := range bundleProfiles {
+			if options.BundleProvisions[key], err = appsign.ParseMobileProvisionFromFile(path); err != nil {
+				return fail(exitInvalidInput, "%s: %v", path, err)
+			}
+		}
+	}
+
+	if *removeArchs != "" {
+		if err = f.RemoveArchitectures(splitList(*removeArchs)...); err != nil {
+			return fail(exitInvalidInput, "-remove-arch: %v", err)
+		}
+	}
+	if *injectDylib != "" {
+		dylib, err := ioutil.ReadFile(*injectDylib)
+		if err != nil {
+			return fail(exitInvalidInput, "%v", err)
+		}
+		if err = f.InjectDylib(filepath.Base(*injectDylib), dylib, *weakDylib); err != nil {
+			return fail(exitInvalidInput, "%s: %v", *injectDylib, err)
+		}
+	}
+
+	if sign.adHoc {
+		err = appsign.ResignIpaAdHoc(f, options, *outPath)
+	} else {
+		setCertificateStorePath(*certDir)
+		err = appsign.ResignIpaWithOptions(f, certBytes, pwd, options, *outPath)
+	}
+	if err != nil {
+		return fail(exitFailure, "resign: %v", err)
+	}
+	return exitOK
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/gamebtc/appsign"
+)
+
+// 对单独的动态库或命令行工具签名，不需要IPA
+func runSign(args []string) int {
+	fs := newFlagSet("sign")
+	inPath := fs.String("in", "", "thin or universal Mach-O `file` to sign")
+	outPath := fs.String("out", "", "output `file`, defaults to signing the input in place")
+	p12Path := fs.String("p12", "", "signing certificate and private key (.p12)")
+	identifier := fs.String("identifier", "", "code signing `identifier`, defaults to the file name without extension")
+	entitlementsPath := fs.String("entitlements", "", "entitlements plist `file` to embed")
+	certDir := fs.String("certs", "", "`directory` holding AppleIncRootCertificate.cer and AppleWWDRCA.cer")
+	var sign signFlags
+	sign.register(fs, "of the signed file")
+	var password passwordFlags
+	password.register(fs)
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if *inPath == "" || (*p12Path == "" && !sign.adHoc) {
+		fs.Usage()
+		return exitUsage
+	}
+	if *outPath == "" {
+		*outPath = *inPath
+	}
+
+	data, err := ioutil.ReadFile(*inPath)
+	if err != nil {
+		return fail(exitInvalidInput, "%v", err)
+	}
+	options := &appsign.MachOSignOptions{Identifier: *identifier}
+	if options.SignOptions, err = sign.signOptions(); err != nil {
+		return fail(exitUsage, "%v", err)
+	}
+	if options.Identifier == "" {
+		options.Identifier = appsign.DefaultIdentifier(*inPath)
+	}
+	if *entitlementsPath != "" {
+		if options.Entitlements, err = appsign.ParseEntitlementsFromFile(*entitlementsPath); err != nil {
+			return fail(exitInvalidInput, "%s: %v", *entitlementsPath, err)
+		}
+	}
+
+	var identity *appsign.SigningIdentity
+	if !sign.adHoc {
+		pwd, err := password.resolve()
+		if err != nil {
+			return fail(exitInvalidInput, "password: %v", err)
+		}
+		certBytes, err := ioutil.ReadFile(*p12Path)
+		if err != nil {
+			return fail(exitInvalidInput, "%v", err)
+		}
+		setCertificateStorePath(*certDir)
+		if identity, err = appsign.LoadSigningIdentity(certBytes, pwd); err != nil {
+			return fail(exitInvalidInput, "%s: %v", *p12Path, err)
+		}
+	}
+	signed, err := appsign.SignMachOBytes(data, identity, options)
+	if err != nil {
+		return fail(exitFailure, "sign: %s: %v", *inPath, err)
+	}
+	mode := os.FileMode(0755)
+	if info, err := os.Stat(*inPath); err == nil {
+		mode = info.Mode()
+	}
+	if err = ioutil.WriteFile(*outPath, signed, mode); err != nil {
+		return fail(exitFailure, "%v", err)
+	}
+	return exitOK
+}
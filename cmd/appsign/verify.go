@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gamebtc/appsign"
+)
+
+func runVerify(args []string) int {
+	fs := newFlagSet("verify")
+	ipaPath := fs.String("ipa", "", "input IPA `file`")
+	certDir := fs.String("certs", "", "`directory` holding AppleIncRootCertificate.cer and AppleWWDRCA.cer")
+	jsonOutput := fs.Bool("json", false, "print the report as JSON")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	f, err := loadIpa(*ipaPath)
+	if err != nil {
+		return fail(exitInvalidInput, "%v", err)
+	}
+
+	setCertificateStorePath(*certDir)
+	report := appsign.VerifyIpa(f)
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(report); err != nil {
+			return fail(exitFailure, "%v", err)
+		}
+	} else if report.OK() {
+		fmt.Printf("OK %s\n", *ipaPath)
+	} else {
+		for _, failure := range report.Failures {
+			fmt.Printf("FAIL %s\n", failure)
+		}
+	}
+	if !report.OK() {
+		return exitVerifyFailed
+	}
+	return exitOK
+}
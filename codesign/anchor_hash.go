@@ -32,4 +32,8 @@ func(v *AnchorHash)GetBytes()[]byte{
 	buffer:= make([]byte, v.Length())
 	v.WriteBytes(buffer)
 	return buffer
-}
\ No newline at end of file
+}
+
+func(v *AnchorHash)String()string {
+	return "certificate " + certSlotString(v.Slot) + " = " + exprHashString(v.Hash)
+}
@@ -27,6 +27,10 @@ func(v *AppleAnchor)GetBytes()[]byte{
 	return buffer
 }
 
+func(v *AppleAnchor)String()string {
+	return "anchor apple"
+}
+
 
 type AppleGenericAnchor struct {
 }
@@ -51,4 +55,8 @@ func(v *AppleGenericAnchor)GetBytes()[]byte{
 	buffer:= make([]byte, v.Length())
 	v.WriteBytes(buffer)
 	return buffer
-}
\ No newline at end of file
+}
+
+func(v *AppleGenericAnchor)String()string {
+	return "anchor apple generic"
+}
@@ -27,6 +27,10 @@ func(v *BooleanFalse)GetBytes()[]byte{
 	return buffer
 }
 
+func(v *BooleanFalse)String()string {
+	return "never"
+}
+
 type BooleanTrue struct {
 }
 
@@ -50,4 +54,8 @@ func(v *BooleanTrue)GetBytes()[]byte{
 	buffer:= make([]byte, v.Length())
 	v.WriteBytes(buffer)
 	return buffer
-}
\ No newline at end of file
+}
+
+func(v *BooleanTrue)String()string {
+	return "always"
+}
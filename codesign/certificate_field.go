@@ -35,4 +35,8 @@ func(v *CertificateField)GetBytes()[]byte{
 	buffer:= make([]byte, v.Length())
 	v.WriteBytes(buffer)
 	return buffer
-}
\ No newline at end of file
+}
+
+func(v *CertificateField)String()string {
+	return "certificate " + certSlotString(v.CertificateIndex) + "[" + exprKeyString(v.FieldName) + "]" + v.Match.String()
+}
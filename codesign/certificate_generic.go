@@ -35,4 +35,8 @@ func(v *CertificateGeneric)GetBytes()[]byte{
 	buffer:= make([]byte, v.Length())
 	v.WriteBytes(buffer)
 	return buffer
-}
\ No newline at end of file
+}
+
+func(v *CertificateGeneric)String()string {
+	return "certificate " + certSlotString(v.CertificateIndex) + "[field." + oidString(v.Oid) + "]" + v.Match.String()
+}
@@ -0,0 +1,42 @@
+package codesign
+
+import "encoding/binary"
+
+type CertificatePolicy struct {
+	CertificateIndex uint32
+	Oid              []byte
+	Match            MatchSuffix
+}
+
+func(v *CertificatePolicy)Length() int {
+	return 8 + ExprDataLen(len(v.Oid)) + v.Match.Length()
+}
+
+func(v *CertificatePolicy)Load(buffer []byte)int {
+	if binary.BigEndian.Uint32(buffer) != ExprCertPolicy {
+		return 0
+	}
+	v.CertificateIndex =  binary.BigEndian.Uint32(buffer[4:])
+	key, n1 := ExprReadData(buffer[8:])
+	v.Oid = key
+	n2 := v.Match.Load(buffer[8+n1:])
+	return 8 + n1 + n2
+}
+
+func(v *CertificatePolicy)WriteBytes(buffer []byte)int {
+	binary.BigEndian.PutUint32(buffer, ExprCertPolicy)
+	binary.BigEndian.PutUint32(buffer[4:], v.CertificateIndex)
+	n1 := ExprWriteData(buffer[8:], v.Oid)
+	n2 := v.Match.WriteBytes(buffer[8+n1:])
+	return 8 + n1 + n2
+}
+
+func(v *CertificatePolicy)GetBytes()[]byte{
+	buffer:= make([]byte, v.Length())
+	v.WriteBytes(buffer)
+	return buffer
+}
+
+func(v *CertificatePolicy)String()string {
+	return "certificate " + certSlotString(v.CertificateIndex) + "[policy." + oidString(v.Oid) + "]" + v.Match.String()
+}
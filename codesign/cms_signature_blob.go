@@ -3,15 +3,18 @@ package codesign
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/binary"
-	"encoding/pem"
-	"fmt"
-	"os"
+	"errors"
+	"sort"
+	"time"
 
-	"go.mozilla.org/pkcs7"
+	"howett.net/plist"
 
-	"github.com/mastahyeti/cms"
 	"github.com/mastahyeti/cms/oid"
 	"github.com/mastahyeti/cms/protocol"
 )
@@ -49,79 +52,240 @@ func(v *CmsSignatureBlob)GetBytes() []byte {
 	return buffer
 }
 
-func CmsGenerateSignature(certChain []*x509.Certificate, privateKey crypto.Signer, messageToSign []byte) []byte {
-	size := len(certChain)
-	signingCertificate := certChain[size-1]
-	cmsChain := make([]*x509.Certificate, size)
-	copy(cmsChain, certChain)
-	for i := 0; i < (size-1)/2; i++ {
-		j := size - 2 - i
-		cmsChain[i], cmsChain[j] = cmsChain[j], cmsChain[i]
+var(
+	AppleCDHashesOID      = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 9, 1} // 所有CodeDirectory的cdhash(plist)
+	AppleHashAgilityV2OID = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 9, 2} // 所有CodeDirectory的hash算法和完整hash
+)
+
+func hashAlgorithmOID(hashType byte)asn1.ObjectIdentifier {
+	if hashType == HashTypeSHA1 {
+		return oid.DigestAlgorithmSHA1
+	}
+	return oid.DigestAlgorithmSHA256
+}
+
+// 多个CodeDirectory时CMS签名需要附带的hash agility属性
+func CreateHashAgilityAttributes(codeDirectories []*CodeDirectory)(protocol.Attributes, error) {
+	cdHashes := make([]interface{}, 0, len(codeDirectories))
+	values := make([]asn1.RawValue, 0, len(codeDirectories))
+	for _, codeDirectory := range codeDirectories {
+		codeBytes := codeDirectory.GetBytes()
+		cdHashes = append(cdHashes, codeDirectory.CDHash())
+		der, err := asn1.Marshal(struct {
+			Algorithm asn1.ObjectIdentifier
+			Digest    []byte
+		}{hashAlgorithmOID(codeDirectory.HashType), ComputeHash(codeDirectory.HashType, codeBytes)})
+		if err != nil {
+			return nil, err
+		}
+		var value asn1.RawValue
+		if _, err = asn1.Unmarshal(der, &value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	cdHashesPlist, err := plist.MarshalIndent(map[string]interface{}{"cdhashes": cdHashes}, plist.XMLFormat, "	")
+	if err != nil {
+		return nil, err
+	}
+	cdHashesAttr, err := protocol.NewAttribute(AppleCDHashesOID, cdHashesPlist)
+	if err != nil {
+		return nil, err
+	}
+	hashAgilityAttr := protocol.Attribute{Type: AppleHashAgilityV2OID}
+	if err = protocol.NewAnySet(values...).Encode(&hashAgilityAttr.RawValue); err != nil {
+		return nil, err
+	}
+	return protocol.Attributes{cdHashesAttr, hashAgilityAttr}, nil
+}
+
+// 同protocol.SignedData.AddSignerInfo，但可以附加额外的签名属性
+func addSignerInfo(sd *protocol.SignedData, chain []*x509.Certificate, signer crypto.Signer, attrs protocol.Attributes)error {
+	pub, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return err
+	}
+	var cert *x509.Certificate
+	for _, c := range chain {
+		if err = sd.AddCertificate(c); err != nil {
+			return err
+		}
+		certPub, err := x509.MarshalPKIXPublicKey(c.PublicKey)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(pub, certPub) {
+			cert = c
+		}
+	}
+	if cert == nil {
+		return protocol.ErrNoCertificate
+	}
+
+	sid, err := protocol.NewIssuerAndSerialNumber(cert)
+	if err != nil {
+		return err
+	}
+	signatureAlgorithm, ok := oid.X509PublicKeyAlgorithmToPKIXAlgorithmIdentifier[cert.PublicKeyAlgorithm]
+	if !ok {
+		return errors.New("unsupported certificate public key algorithm")
+	}
+	si := protocol.SignerInfo{
+		Version:            1,
+		SID:                sid,
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oid.DigestAlgorithmSHA256},
+		SignatureAlgorithm: signatureAlgorithm,
+	}
+
+	content, err := sd.EncapContentInfo.EContentValue()
+	if err != nil {
+		return err
+	}
+	hash, err := si.Hash()
+	if err != nil {
+		return err
+	}
+	md := hash.New()
+	md.Write(content)
+
+	ctAttr, err := protocol.NewAttribute(oid.AttributeContentType, sd.EncapContentInfo.EContentType)
+	if err != nil {
+		return err
 	}
-	//certChain = cmsChain
-	certificateStore := x509.NewCertPool()
-	for _, cert := range cmsChain {
-		certificateStore.AddCert(cert)
+	stAttr, err := protocol.NewAttribute(oid.AttributeSigningTime, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	mdAttr, err := protocol.NewAttribute(oid.AttributeMessageDigest, md.Sum(nil))
+	if err != nil {
+		return err
+	}
+	si.SignedAttrs = append(protocol.Attributes{ctAttr, stAttr, mdAttr}, attrs...)
+	if err = sortAttributes(si.SignedAttrs); err != nil {
+		return err
 	}
 
-	eci, _ := protocol.NewEncapsulatedContentInfo(oid.ContentTypeData, messageToSign)
-	sd, _ := protocol.NewSignedData(eci)
+	sm, err := marshalSignedAttributes(si.SignedAttrs)
+	if err != nil {
+		return err
+	}
+	smd := hash.New()
+	smd.Write(sm)
+	if si.Signature, err = signer.Sign(rand.Reader, smd.Sum(nil), hash); err != nil {
+		return err
+	}
 
+	sd.DigestAlgorithms = append(sd.DigestAlgorithms, si.DigestAlgorithm)
+	sd.SignerInfos = append(sd.SignerInfos, si)
+	return nil
+}
 
-	sd.AddSignerInfo(cmsChain, privateKey)
+// 按DER编码排序的属性
+type attributesByEncoding struct {
+	attrs   protocol.Attributes
+	encoded [][]byte
+}
 
-	der, _ := sd.ContentInfoDER()
-	der2, _ := cms.Sign(messageToSign, cmsChain, privateKey)
+func(a attributesByEncoding)Len()int {
+	return len(a.attrs)
+}
 
-	der3, _ := cms.SignDetached(messageToSign, cmsChain, privateKey)
+func(a attributesByEncoding)Less(i, j int)bool {
+	return bytes.Compare(a.encoded[i], a.encoded[j]) < 0
+}
 
-	der4, _:=SignAndDetach(messageToSign, signingCertificate, privateKey)
+func(a attributesByEncoding)Swap(i, j int) {
+	a.attrs[i], a.attrs[j] = a.attrs[j], a.attrs[i]
+	a.encoded[i], a.encoded[j] = a.encoded[j], a.encoded[i]
+}
 
-	if len(der2) > 1000000000 && len(der3) > 100000  && len(der4)>100000{
-		return der2
+// SignerInfo中的SignedAttrs按原顺序写入，签名时则按DER的SET OF排序，
+// 两者必须相同，所以先按每个属性的DER编码排序
+func sortAttributes(attrs protocol.Attributes)error {
+	encoded := make([][]byte, len(attrs))
+	for i, attr := range attrs {
+		der, err := asn1.Marshal(attr)
+		if err != nil {
+			return err
+		}
+		encoded[i] = der
 	}
-	return der
+	sort.Sort(attributesByEncoding{attrs, encoded})
+	return nil
 }
 
-func SignAndDetach(content []byte, cert *x509.Certificate, privkey crypto.PrivateKey) (signed []byte, err error) {
-	toBeSigned, err := pkcs7.NewSignedData(content)
+// 签名和校验时按SignerInfo中的原顺序编码签名属性(SET OF标记)，不重新排序
+func marshalSignedAttributes(attrs protocol.Attributes)([]byte, error) {
+	der, err := asn1.Marshal([]protocol.Attribute(attrs))
 	if err != nil {
-		err = fmt.Errorf("Cannot initialize signed data: %s", err)
-		return
+		return nil, err
 	}
-	if err = toBeSigned.AddSigner(cert, privkey, pkcs7.SignerInfoConfig{}); err != nil {
-		err = fmt.Errorf("Cannot add signer: %s", err)
-		return
+	der[0] = asn1.TagSet | 0x20
+	return der, nil
+}
+
+// ECDSA签名的长度每次都可能不同，预留签名空间时需要在一次签名的长度上增加的空间
+// 签名变长时外层的DER长度字段也可能变长
+func cmsSignatureSlack(privateKey crypto.Signer)int {
+	if privateKey == nil {
+		return 0
 	}
+	slack := 16
+	if key, ok := privateKey.Public().(*ecdsa.PublicKey); ok {
+		// 最长的签名：SEQUENCE中r和s各为size+1字节(带前导0)的INTEGER
+		size := (key.Curve.Params().BitSize + 7) / 8
+		slack += 3 + 2*(2+size+1)
+	}
+	return slack
+}
 
-	// Detach signature, omit if you want an embedded signature
-	toBeSigned.Detach()
+// 生成分离式(detached)的CMS SignedData，签名内容为CodeDirectory，与codesign的格式相同：
+// SHA-256摘要，签名属性为content-type、signing-time、message-digest和attrs(cdhashes等)，按DER编码排序
+// certChain的顺序为根证书、WWDR、签名证书，CMS中的证书顺序为签名证书、WWDR、根证书
+func CmsGenerateSignature(certChain []*x509.Certificate, privateKey crypto.Signer, messageToSign []byte, attrs protocol.Attributes)([]byte, error) {
+	if len(certChain) == 0 {
+		return nil, errors.New("missing signing certificate")
+	}
+	cmsChain := make([]*x509.Certificate, len(certChain))
+	for i, cert := range certChain {
+		cmsChain[len(certChain)-1-i] = cert
+	}
 
-	signed, err = toBeSigned.Finish()
+	eci, err := protocol.NewDataEncapsulatedContentInfo(messageToSign)
 	if err != nil {
-		err = fmt.Errorf("Cannot finish signing data: %s", err)
-		return
+		return nil, err
 	}
-
-	// Verify the signature
-	pem.Encode(os.Stdout, &pem.Block{Type: "PKCS7", Bytes: signed})
-	p7, err := pkcs7.Parse(signed)
+	sd, err := protocol.NewSignedData(eci)
 	if err != nil {
-		err = fmt.Errorf("Cannot parse our signed data: %s", err)
-		return
+		return nil, err
 	}
+	if err = addSignerInfo(sd, cmsChain, privateKey, attrs); err != nil {
+		return nil, err
+	}
+	// 签名后去掉内容，CodeDirectory单独保存在签名中
+	sd.EncapContentInfo.EContent = asn1.RawValue{}
+	return marshalSignedData(sd)
+}
 
-	// since the signature was detached, reattach the content here
-	p7.Content = content
+// 同protocol.SignedData，但证书不使用set标记：asn1编码时会对SET OF排序，
+// 而codesign按签名证书、WWDR、根证书的顺序写入，每个证书是一个单独的元素
+type orderedSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo protocol.EncapsulatedContentInfo
+	Certificates     []asn1.RawValue            `asn1:"optional,tag:0"`
+	CRLs             []asn1.RawValue            `asn1:"optional,set,tag:1"`
+	SignerInfos      []protocol.SignerInfo      `asn1:"set"`
+}
 
-	if bytes.Compare(content, p7.Content) != 0 {
-		err = fmt.Errorf("Our content was not in the parsed data:\n\tExpected: %s\n\tActual: %s", content, p7.Content)
-		return
-	}
-	if err = p7.Verify(); err != nil {
-		err = fmt.Errorf("Cannot verify our signed data: %s", err)
-		return
+func marshalSignedData(sd *protocol.SignedData)([]byte, error) {
+	der, err := asn1.Marshal(orderedSignedData(*sd))
+	if err != nil {
+		return nil, err
 	}
-
-	return signed, nil
-}
\ No newline at end of file
+	return asn1.Marshal(protocol.ContentInfo{
+		ContentType: oid.ContentTypeSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der},
+	})
+}
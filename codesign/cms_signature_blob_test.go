@@ -0,0 +1,228 @@
+package codesign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mastahyeti/cms/protocol"
+)
+
+// 测试用的证书链：根证书、中间证书和签名证书(顺序同ResignExecutable的certChain)
+func testCertChain(t testing.TB, key crypto.Signer)[]*x509.Certificate {
+	var chain []*x509.Certificate
+	parentKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"Test Root CA", "Test Intermediate CA", "Apple Development: Test (TEAMID1234)"}
+	for i, name := range names {
+		certKey := crypto.Signer(parentKey)
+		if i == len(names)-1 {
+			certKey = key
+		} else if i > 0 {
+			if certKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+				t.Fatal(err)
+			}
+		}
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(int64(i + 1)),
+			Subject:               pkix.Name{CommonName: name, OrganizationalUnit: []string{"TEAMID1234"}},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  i < len(names)-1,
+		}
+		parent := template
+		if i > 0 {
+			parent = chain[i-1]
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, certKey.Public(), parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, cert)
+		parentKey = certKey.(*ecdsa.PrivateKey)
+	}
+	return chain
+}
+
+// 返回指定长度签名的ECDSA私钥，模拟r和s最短和最长时的签名
+type fixedLengthSigner struct {
+	*ecdsa.PrivateKey
+	length int
+}
+
+func(s *fixedLengthSigner)Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts)([]byte, error) {
+	return make([]byte, s.length), nil
+}
+
+func TestCmsSignatureSlack(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain := testCertChain(t, key)
+		message := CreateCodeDirectory(0x1000, "com.example.app", "TEAMID1234", HashTypeSHA256).GetBytes()
+		size := (curve.Params().BitSize + 7) / 8
+		// 最短：SEQUENCE{INTEGER 0, INTEGER 0}，最长：r和s都带前导0
+		shortest, err := CmsGenerateSignature(chain, &fixedLengthSigner{key, 8}, message, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		longest, err := CmsGenerateSignature(chain, &fixedLengthSigner{key, 3 + 2*(2+size+1)}, message, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(longest) > len(shortest)+cmsSignatureSlack(key) {
+			t.Errorf("%s: longest signature %d exceeds reserved %d+%d", curve.Params().Name,
+				len(longest), len(shortest), cmsSignatureSlack(key))
+		}
+
+		// 真实的签名
+		first, err := CmsGenerateSignature(chain, key, message, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 64; i++ {
+			der, err := CmsGenerateSignature(chain, key, message, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(der) > len(first)+cmsSignatureSlack(key) {
+				t.Fatalf("%s: signature %d exceeds reserved %d+%d", curve.Params().Name,
+					len(der), len(first), cmsSignatureSlack(key))
+			}
+		}
+	}
+}
+
+// 只解析SignerInfo中签名属性的原始编码
+type rawSignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type rawSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo asn1.RawValue
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	SignerInfos      []rawSignerInfo `asn1:"set"`
+}
+
+func TestCmsGenerateSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := testCertChain(t, key)
+	codeDirectories := []*CodeDirectory{
+		CreateCodeDirectory(0x1000, "com.example.app", "TEAMID1234", HashTypeSHA1),
+		CreateCodeDirectory(0x1000, "com.example.app", "TEAMID1234", HashTypeSHA256),
+	}
+	attrs, err := CreateHashAgilityAttributes(codeDirectories)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := codeDirectories[0].GetBytes()
+	der, err := CmsGenerateSignature(chain, key, message, attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ci, err := protocol.ParseContentInfo(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := ci.SignedDataContent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每个证书是单独的元素，顺序为签名证书、中间证书、根证书
+	certs, err := sd.X509Certificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != len(chain) {
+		t.Fatalf("expected %d certificates, found %d", len(chain), len(certs))
+	}
+	for i, cert := range certs {
+		if !cert.Equal(chain[len(chain)-1-i]) {
+			t.Errorf("certificate %d is %q", i, cert.Subject.CommonName)
+		}
+	}
+
+	// 签名属性按DER编码排序，签名是对SignerInfo中原始编码的签名
+	var raw rawSignedData
+	if _, err = asn1.Unmarshal(ci.Content.Bytes, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(raw.SignerInfos) != 1 {
+		t.Fatalf("expected one signer, found %d", len(raw.SignerInfos))
+	}
+	si := raw.SignerInfos[0]
+	var previous []byte
+	for _, attr := range sd.SignerInfos[0].SignedAttrs {
+		encoded, err := asn1.Marshal(attr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Compare(previous, encoded) > 0 {
+			t.Errorf("signed attribute %v is out of DER order", attr.Type)
+		}
+		previous = encoded
+	}
+	signedAttrs := append([]byte{asn1.TagSet | 0x20}, si.SignedAttrs.FullBytes[1:]...)
+	if err = chain[len(chain)-1].CheckSignature(x509.ECDSAWithSHA256, signedAttrs, si.Signature); err != nil {
+		t.Errorf("signature does not cover the encoded signed attributes: %v", err)
+	}
+
+	// 使用openssl校验
+	openssl, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl not found")
+	}
+	dir, err := ioutil.TempDir("", "cms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	signaturePath := filepath.Join(dir, "signature.der")
+	contentPath := filepath.Join(dir, "code_directory")
+	if err = ioutil.WriteFile(signaturePath, der, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(contentPath, message, 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err := exec.Command(openssl, "cms", "-verify", "-binary", "-noverify", "-inform", "DER",
+		"-in", signaturePath, "-content", contentPath, "-out", os.DevNull).CombinedOutput()
+	if err != nil {
+		t.Errorf("openssl cms -verify: %v\n%s", err, output)
+	}
+}
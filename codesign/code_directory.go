@@ -10,16 +10,35 @@ const(
 	CDB_TeamIDMinimumVersion      = 0x20200
 	CDB_CodeLimit64MinimumVersion = 0x20300
 	CDB_ExecSegMinimumVersion     = 0x20400
+	CDB_RuntimeMinimumVersion     = 0x20500
+	CDB_LinkageMinimumVersion     = 0x20600
 
 	CDB_FixedLengthV20001 = 44
-	CDB_FixedLengthV20100 = 48
-	CDB_FixedLengthV20200 = 52
+	CDB_FixedLengthV20100 = 48  // + scatterOffset
+	CDB_FixedLengthV20200 = 52  // + teamOffset
+	CDB_FixedLengthV20300 = 64  // + spare3, codeLimit64
+	CDB_FixedLengthV20400 = 88  // + execSegBase, execSegLimit, execSegFlags
+	CDB_FixedLengthV20500 = 96  // + runtime, preEncryptOffset
+	CDB_FixedLengthV20600 = 108 // + linkageHashType, linkageApplicationType, linkageApplicationSubType, linkageOffset, linkageSize
 
 	CDB_InfoFileHashOffset = 1
 	CDB_RequirementsHashOffset = 2
 	CDB_CodeResourcesFileHashOffset = 3
 	CDB_ApplicationSpecificHashOffset = 4
 	CDB_EntitlementsHashOffset = 5
+	CDB_RepSpecificHashOffset = 6
+	CDB_DerEntitlementsHashOffset = 7
+)
+
+// CodeDirectory的ExecSegFlags
+const(
+	CS_ExecSegMainBinary = 0x1      // CS_EXECSEG_MAIN_BINARY
+	CS_ExecSegAllowUnsigned = 0x10  // CS_EXECSEG_ALLOW_UNSIGNED
+	CS_ExecSegDebugger = 0x20       // CS_EXECSEG_DEBUGGER
+	CS_ExecSegJit = 0x40            // CS_EXECSEG_JIT
+	CS_ExecSegSkipLV = 0x80         // CS_EXECSEG_SKIP_LV
+	CS_ExecSegCanLoadCDHash = 0x100 // CS_EXECSEG_CAN_LOAD_CDHASH
+	CS_ExecSegCanExecCDHash = 0x200 // CS_EXECSEG_CAN_EXEC_CDHASH
 )
 
 const(
@@ -65,6 +84,13 @@ type CodeDirectory struct {
 	ExecSegBase   uint64 // Version 0x20400
 	ExecSegLimit  uint64 // Version 0x20400
 	ExecSegFlags  uint64 // Version 0x20400
+	Runtime          uint32 // Version 0x20500，hardened runtime的SDK版本
+	PreEncryptOffset uint32 // Version 0x20500
+	LinkageHashType           uint8  // Version 0x20600
+	LinkageApplicationType    uint8  // Version 0x20600
+	LinkageApplicationSubType uint16 // Version 0x20600
+	LinkageOffset             uint32 // Version 0x20600
+	LinkageSize               uint32 // Version 0x20600
 	Ident         string
 	TeamID        string // Version 0x20200
 	SpecialHashes [][]byte
@@ -107,6 +133,17 @@ func(c *CodeDirectory)Load(buffer []byte)int {
 					c.ExecSegBase = binary.BigEndian.Uint64(buffer[64:])
 					c.ExecSegLimit = binary.BigEndian.Uint64(buffer[72:])
 					c.ExecSegFlags = binary.BigEndian.Uint64(buffer[80:])
+					if c.Version >= CDB_RuntimeMinimumVersion {
+						c.Runtime = binary.BigEndian.Uint32(buffer[88:])
+						c.PreEncryptOffset = binary.BigEndian.Uint32(buffer[92:])
+						if c.Version >= CDB_LinkageMinimumVersion {
+							c.LinkageHashType = buffer[96]
+							c.LinkageApplicationType = buffer[97]
+							c.LinkageApplicationSubType = binary.BigEndian.Uint16(buffer[98:])
+							c.LinkageOffset = binary.BigEndian.Uint32(buffer[100:])
+							c.LinkageSize = binary.BigEndian.Uint32(buffer[104:])
+						}
+					}
 				}
 			}
 		}
@@ -131,7 +168,7 @@ func(c *CodeDirectory)Load(buffer []byte)int {
 		c.CodeHashes = append(c.CodeHashes, hash)
 	}
 
-	return 0
+	return int(binary.BigEndian.Uint32(buffer[4:]))
 }
 
 func(c *CodeDirectory)Length()int {
@@ -149,17 +186,26 @@ func(c *CodeDirectory)Length()int {
 }
 
 func (c *CodeDirectory) fixedLength()int {
-	l := CDB_FixedLengthV20001
-	if c.Version >= CDB_ExecSegMinimumVersion {
-		l += 24 + 20
-	} else if c.Version >= CDB_CodeLimit64MinimumVersion {
-		l += 12 + 8
-	} else if c.Version >= CDB_TeamIDMinimumVersion {
-		l += 4 + 4
-	} else if c.Version >= CDB_ScatterMinimumVersion {
-		l += 4
+	return codeDirectoryFixedLength(c.Version)
+}
+
+// 各版本CodeDirectory头部的长度
+func codeDirectoryFixedLength(version uint32)int {
+	switch {
+	case version >= CDB_LinkageMinimumVersion:
+		return CDB_FixedLengthV20600
+	case version >= CDB_RuntimeMinimumVersion:
+		return CDB_FixedLengthV20500
+	case version >= CDB_ExecSegMinimumVersion:
+		return CDB_FixedLengthV20400
+	case version >= CDB_CodeLimit64MinimumVersion:
+		return CDB_FixedLengthV20300
+	case version >= CDB_TeamIDMinimumVersion:
+		return CDB_FixedLengthV20200
+	case version >= CDB_ScatterMinimumVersion:
+		return CDB_FixedLengthV20100
 	}
-	return l
+	return CDB_FixedLengthV20001
 }
 
 func(c *CodeDirectory)write(buffer []byte, length int) {
@@ -206,6 +252,17 @@ func(c *CodeDirectory)write(buffer []byte, length int) {
 					binary.BigEndian.PutUint64(buffer[64:], c.ExecSegBase)
 					binary.BigEndian.PutUint64(buffer[72:], c.ExecSegLimit)
 					binary.BigEndian.PutUint64(buffer[80:], c.ExecSegFlags)
+					if c.Version >= CDB_RuntimeMinimumVersion {
+						binary.BigEndian.PutUint32(buffer[88:], c.Runtime)
+						binary.BigEndian.PutUint32(buffer[92:], c.PreEncryptOffset)
+						if c.Version >= CDB_LinkageMinimumVersion {
+							buffer[96] = c.LinkageHashType
+							buffer[97] = c.LinkageApplicationType
+							binary.BigEndian.PutUint16(buffer[98:], c.LinkageApplicationSubType)
+							binary.BigEndian.PutUint32(buffer[100:], c.LinkageOffset)
+							binary.BigEndian.PutUint32(buffer[104:], c.LinkageSize)
+						}
+					}
 				}
 			}
 		}
@@ -213,12 +270,12 @@ func(c *CodeDirectory)write(buffer []byte, length int) {
 
 	if c.Ident != "" {
 		copy(buffer[identOffset:], c.Ident)
-		buffer[identOffset+1+len(c.Ident)] = 0
+		buffer[identOffset+len(c.Ident)] = 0
 	}
 
 	if c.Version >= CDB_TeamIDMinimumVersion && c.TeamID != "" {
 		copy(buffer[teamIDOffset:], c.TeamID)
-		buffer[teamIDOffset+1+len(c.TeamID)] = 0
+		buffer[teamIDOffset+len(c.TeamID)] = 0
 	}
 
 	if len(c.SpecialHashes) > 0 {
@@ -255,16 +312,45 @@ func(c *CodeDirectory)GetBytes()[]byte {
 	return buffer
 }
 
+// 特殊槽位的hash，slot从1开始(CDB_InfoFileHashOffset等)，不存在时返回nil
+func(c *CodeDirectory)SpecialHash(slot int)[]byte {
+	if slot < 1 || slot > len(c.SpecialHashes) {
+		return nil
+	}
+	return c.SpecialHashes[len(c.SpecialHashes)-slot]
+}
+
+// cdhash, 截取前20字节
+func(c *CodeDirectory)CDHash()[]byte {
+	return ComputeHash(c.HashType, c.GetBytes())[:SHA1Length]
+}
+
 func IsCodeDirectory(buffer []byte)bool {
 	magic := binary.BigEndian.Uint32(buffer)
 	return magic == CSMAGIC_CODEDIRECTORY
 }
 
+// 设置可执行段(__TEXT)的范围和标志
+func(c *CodeDirectory)SetExecSegment(base, limit, flags uint64) {
+	c.ExecSegBase = base
+	c.ExecSegLimit = limit
+	c.ExecSegFlags = flags
+}
+
+// 设置hardened runtime的版本(SDK版本)，CodeDirectory至少为0x20500
+func(c *CodeDirectory)SetRuntime(version uint32) {
+	c.Runtime = version
+	if c.Version < CDB_RuntimeMinimumVersion {
+		c.Version = CDB_RuntimeMinimumVersion
+	}
+}
+
+// 新建0x20400版本的CodeDirectory，需要另外设置可执行段
 func CreateCodeDirectory(codeLength uint32 , ident string , teamID string , hashType byte )*CodeDirectory {
 	const pageSize = 4096
 	hashSize := GetHashLength(hashType)
 	codeDirectory := &CodeDirectory{
-		Version:   CDB_TeamIDMinimumVersion,
+		Version:   CDB_ExecSegMinimumVersion,
 		CodeLimit: codeLength,
 		HashType:  hashType,
 		HashSize:  hashSize,
@@ -29,4 +29,8 @@ func(v *CodeDirectoryHash)GetBytes()[]byte {
 	buffer := make([]byte, v.Length())
 	v.WriteBytes(buffer)
 	return buffer
-}
\ No newline at end of file
+}
+
+func(v *CodeDirectoryHash)String()string {
+	return "cdhash " + exprHashString(v.Hash)
+}
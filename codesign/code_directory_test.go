@@ -0,0 +1,152 @@
+package codesign
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/gamebtc/appsign/mach"
+)
+
+func TestCodeDirectoryVersions(t *testing.T) {
+	tests := []struct {
+		version uint32
+		length  int
+	}{
+		{CDB_ExecSegMinimumVersion, CDB_FixedLengthV20400},
+		{CDB_RuntimeMinimumVersion, CDB_FixedLengthV20500},
+		{CDB_LinkageMinimumVersion, CDB_FixedLengthV20600},
+	}
+	for _, test := range tests {
+		codeDirectory := CreateCodeDirectory(0x2800, "com.example.app", "TEAMID1234", HashTypeSHA256)
+		codeDirectory.Version = test.version
+		codeDirectory.SetExecSegment(0x4000, 0x8000, CS_ExecSegMainBinary|CS_ExecSegAllowUnsigned)
+		if test.version >= CDB_RuntimeMinimumVersion {
+			codeDirectory.Runtime = 0xf0500
+			codeDirectory.PreEncryptOffset = 0x1234
+		}
+		if test.version >= CDB_LinkageMinimumVersion {
+			codeDirectory.LinkageHashType = HashTypeSHA256
+			codeDirectory.LinkageApplicationType = 1
+			codeDirectory.LinkageApplicationSubType = 2
+		}
+		data := codeDirectory.GetBytes()
+		// 头部之后依次为标识符、team ID和hash
+		if identOffset := binary.BigEndian.Uint32(data[20:]); identOffset != uint32(test.length) {
+			t.Errorf("0x%x: identifier at %d, expected header length %d", test.version, identOffset, test.length)
+		}
+		if teamIDOffset := binary.BigEndian.Uint32(data[48:]); teamIDOffset != uint32(test.length+len("com.example.app")+1) {
+			t.Errorf("0x%x: team ID at %d", test.version, teamIDOffset)
+		}
+		if len(data) != codeDirectory.Length() {
+			t.Errorf("0x%x: wrote %d bytes, length %d", test.version, len(data), codeDirectory.Length())
+		}
+
+		read := new(CodeDirectory)
+		if n := read.Load(data); n != len(data) {
+			t.Fatalf("0x%x: read %d bytes, expected %d", test.version, n, len(data))
+		}
+		if read.Version != test.version || read.Ident != "com.example.app" || read.TeamID != "TEAMID1234" ||
+			read.ExecSegBase != 0x4000 || read.ExecSegLimit != 0x8000 ||
+			read.ExecSegFlags != CS_ExecSegMainBinary|CS_ExecSegAllowUnsigned ||
+			read.Runtime != codeDirectory.Runtime || read.PreEncryptOffset != codeDirectory.PreEncryptOffset ||
+			read.LinkageHashType != codeDirectory.LinkageHashType ||
+			read.LinkageApplicationType != codeDirectory.LinkageApplicationType ||
+			read.LinkageApplicationSubType != codeDirectory.LinkageApplicationSubType ||
+			len(read.CodeHashes) != 3 || len(read.SpecialHashes) != SpecialHashCount {
+			t.Errorf("0x%x: code directory did not round-trip: %+v", test.version, read)
+		}
+		if !bytes.Equal(read.GetBytes(), data) {
+			t.Errorf("0x%x: rewritten code directory differs", test.version)
+		}
+	}
+
+	// hardened runtime需要0x20500
+	codeDirectory := CreateCodeDirectory(0x1000, "com.example.app", "", HashTypeSHA256)
+	if codeDirectory.Version != CDB_ExecSegMinimumVersion {
+		t.Errorf("new code directory version 0x%x, expected 0x20400", codeDirectory.Version)
+	}
+	codeDirectory.SetRuntime(0xf0500)
+	if codeDirectory.Version != CDB_RuntimeMinimumVersion || codeDirectory.Runtime != 0xf0500 {
+		t.Errorf("runtime code directory version 0x%x runtime 0x%x", codeDirectory.Version, codeDirectory.Runtime)
+	}
+}
+
+// 64位的arm64 Mach-O：__TEXT为文件的前0x1000字节，之后是__LINKEDIT
+func testMachObject(t *testing.T, fileType uint32)*mach.MachObjectFile {
+	text := &mach.SegmentCommand64{VMAddress: 0x100000000, VMSize: 0x1000, FileSize: 0x1000, MaxProt: 5, InitProt: 5}
+	copy(text.SegmentName[:], mach.TextSegmentName)
+	text.CommandSize = uint32(text.Length())
+	linkEdit := &mach.SegmentCommand64{VMAddress: 0x100001000, VMSize: 0x4000, FileOffset: 0x1000, FileSize: 0x40,
+		MaxProt: 1, InitProt: 1}
+	copy(linkEdit.SegmentName[:], mach.LinkEditSegmentName)
+	linkEdit.CommandSize = uint32(linkEdit.Length())
+	commands := []mach.Entity{text, linkEdit,
+		&mach.BuildVersionCommand{Platform: mach.PlatformIOS, MinOS: 0xc0000, SDK: 0xf0500}}
+	header := &mach.MachHeader{Is64BitHeader: true, CpuType: mach.CpuTypeArm64, FileType: fileType}
+	for _, command := range commands {
+		header.NumberOfLoadCommands++
+		header.SizeOfLoadCommands += uint32(command.Length())
+	}
+	dataOffset := header.Length() + int(header.SizeOfLoadCommands)
+	file := &mach.MachObjectFile{Header: header, LoadCommands: commands, DataOffset: dataOffset,
+		Data: make([]byte, 0x1040-dataOffset)}
+	files, err := mach.ReadMachObjects(file.GetBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files[0]
+}
+
+func TestResignExecutableCodeDirectory(t *testing.T) {
+	runtime := uint32(CS_Runtime)
+	tests := []struct {
+		name         string
+		fileType     uint32
+		entitlements map[string]interface{}
+		flags        *uint32
+		version      uint32
+		execSegFlags uint64
+		runtime      uint32
+	}{
+		{"executable", mach.FileTypeExecutable, nil, nil, CDB_ExecSegMinimumVersion, CS_ExecSegMainBinary, 0},
+		{"get-task-allow", mach.FileTypeExecutable, map[string]interface{}{"get-task-allow": true}, nil,
+			CDB_ExecSegMinimumVersion, CS_ExecSegMainBinary | CS_ExecSegAllowUnsigned, 0},
+		{"get-task-allow false", mach.FileTypeExecutable, map[string]interface{}{"get-task-allow": false}, nil,
+			CDB_ExecSegMinimumVersion, CS_ExecSegMainBinary, 0},
+		{"runtime", mach.FileTypeExecutable, nil, &runtime, CDB_RuntimeMinimumVersion, CS_ExecSegMainBinary, 0xf0500},
+		{"dylib", mach.FileTypeDynamicLibrary, map[string]interface{}{"get-task-allow": true}, &runtime,
+			CDB_RuntimeMinimumVersion, 0, 0xf0500},
+	}
+	for _, test := range tests {
+		file := testMachObject(t, test.fileType)
+		options := &SignOptions{AdHoc: true, Flags: test.flags}
+		if _, err := ResignExecutable(file, "com.example.app", nil, nil, nil, nil, test.entitlements, options); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		files, err := mach.ReadMachObjects(file.GetBytes())
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		signature, err := ParseEmbeddedSignature(files[0])
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for _, codeDirectory := range signature.CodeDirectories {
+			if codeDirectory.Version != test.version {
+				t.Errorf("%s: version 0x%x, expected 0x%x", test.name, codeDirectory.Version, test.version)
+			}
+			if codeDirectory.ExecSegBase != 0 || codeDirectory.ExecSegLimit != 0x1000 {
+				t.Errorf("%s: exec segment 0x%x+0x%x, expected __TEXT 0+0x1000", test.name,
+					codeDirectory.ExecSegBase, codeDirectory.ExecSegLimit)
+			}
+			if codeDirectory.ExecSegFlags != test.execSegFlags {
+				t.Errorf("%s: exec segment flags 0x%x, expected 0x%x", test.name, codeDirectory.ExecSegFlags, test.execSegFlags)
+			}
+			if codeDirectory.Runtime != test.runtime {
+				t.Errorf("%s: runtime 0x%x, expected 0x%x", test.name, codeDirectory.Runtime, test.runtime)
+			}
+		}
+	}
+}
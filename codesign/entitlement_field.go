@@ -0,0 +1,39 @@
+package codesign
+
+import "encoding/binary"
+
+type EntitlementField struct {
+	Key   []byte
+	Match MatchSuffix
+}
+
+func(v *EntitlementField)Length() int {
+	return 4 + ExprDataLen(len(v.Key)) + v.Match.Length()
+}
+
+func(v *EntitlementField)Load(buffer []byte)int {
+	if binary.BigEndian.Uint32(buffer) != ExprEntitlementField {
+		return 0
+	}
+	key, n1 := ExprReadData(buffer[4:])
+	v.Key = key
+	n2 := v.Match.Load(buffer[4+n1:])
+	return 4 + n1 + n2
+}
+
+func(v *EntitlementField)WriteBytes(buffer []byte)int {
+	binary.BigEndian.PutUint32(buffer, ExprEntitlementField)
+	n1 := ExprWriteData(buffer[4:], v.Key)
+	n2 := v.Match.WriteBytes(buffer[4+n1:])
+	return 4 + n1 + n2
+}
+
+func(v *EntitlementField)GetBytes()[]byte {
+	buffer := make([]byte, v.Length())
+	v.WriteBytes(buffer)
+	return buffer
+}
+
+func(v *EntitlementField)String()string {
+	return "entitlement [" + exprKeyString(v.Key) + "]" + v.Match.String()
+}
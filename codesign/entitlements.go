@@ -1,5 +1,13 @@
 package codesign
 
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
 
 const CSMAGIC_EMBEDDED_ENTITLEMENTS = 0xfade7171 // CSMAGIC_EMBEDDED_ENTITLEMENTS
 type Entitlements struct {
@@ -12,4 +20,100 @@ func NewEntitlements()*Entitlements {
 			Magic: CSMAGIC_EMBEDDED_ENTITLEMENTS,
 		},
 	}
-}
\ No newline at end of file
+}
+
+const CSMAGIC_EMBEDDED_DER_ENTITLEMENTS = 0xfade7172 // CSMAGIC_EMBEDDED_DER_ENTITLEMENTS
+type DerEntitlements struct {
+	CodeSignatureGenericBlob
+}
+
+func NewDerEntitlements()*DerEntitlements {
+	return &DerEntitlements{
+		CodeSignatureGenericBlob{
+			Magic: CSMAGIC_EMBEDDED_DER_ENTITLEMENTS,
+		},
+	}
+}
+
+// 按照Apple的格式将entitlements编码为DER:
+// [APPLICATION 16] { INTEGER 1, dict }
+// dict为 [CONTEXT 16] SET OF SEQUENCE { UTF8String key, value }，按key排序
+func MarshalDerEntitlements(entitlements EntitlementsFile)([]byte, error) {
+	dict, err := marshalDerDict(entitlements)
+	if err != nil {
+		return nil, err
+	}
+	version, _ := asn1.Marshal(1)
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassApplication,
+		Tag:        16,
+		IsCompound: true,
+		Bytes:      append(version, dict...),
+	})
+}
+
+func marshalDerDict(dict map[string]interface{})([]byte, error) {
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var items []byte
+	for _, key := range keys {
+		k, err := asn1.MarshalWithParams(key, "utf8")
+		if err != nil {
+			return nil, err
+		}
+		v, err := marshalDerValue(dict[key])
+		if err != nil {
+			return nil, fmt.Errorf("entitlement %q: %v", key, err)
+		}
+		item, _ := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: append(k, v...)})
+		items = append(items, item...)
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 16, IsCompound: true, Bytes: items})
+}
+
+func marshalDerValue(value interface{})([]byte, error) {
+	switch v := value.(type) {
+	case bool:
+		return asn1.Marshal(v)
+	case string:
+		return asn1.MarshalWithParams(v, "utf8")
+	case int64:
+		return asn1.Marshal(v)
+	case uint64:
+		return asn1.Marshal(new(big.Int).SetUint64(v))
+	case int:
+		return asn1.Marshal(int64(v))
+	case []interface{}:
+		var items []byte
+		for _, item := range v {
+			b, err := marshalDerValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, b...)
+		}
+		return asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: items})
+	case []string:
+		var items []byte
+		for _, item := range v {
+			b, err := asn1.MarshalWithParams(item, "utf8")
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, b...)
+		}
+		return asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: items})
+	case map[string]interface{}:
+		return marshalDerDict(v)
+	case []byte:
+		return nil, errors.New("<data> values are not supported in DER entitlements")
+	case time.Time:
+		return nil, errors.New("<date> values are not supported in DER entitlements")
+	case float32, float64:
+		return nil, errors.New("<real> values are not supported in DER entitlements")
+	}
+	return nil, fmt.Errorf("unsupported value type %T", value)
+}
@@ -0,0 +1,64 @@
+package codesign
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"howett.net/plist"
+)
+
+func testEntitlementsPlist(t *testing.T, body string)EntitlementsFile {
+	text := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0"><dict>` + body + `</dict></plist>`
+	var entitlements EntitlementsFile
+	if _, err := plist.Unmarshal([]byte(text), &entitlements); err != nil {
+		t.Fatal(err)
+	}
+	return entitlements
+}
+
+func TestMarshalDerEntitlements(t *testing.T) {
+	// 输入的key没有排序
+	entitlements := testEntitlementsPlist(t, `
+	<key>z-bool</key><true/>
+	<key>m-string</key><string>x</string>
+	<key>c-dict</key><dict><key>k</key><false/></dict>
+	<key>a-int</key><integer>42</integer>
+	<key>b-array</key><array><string>p</string><string>q</string></array>`)
+	// [APPLICATION 16] { INTEGER 1, [CONTEXT 16] { SEQUENCE { UTF8String key, value } ... } }
+	want, _ := hex.DecodeString("7054" + "020101" + "b04f" +
+		"300a" + "0c05612d696e74" + "02012a" +
+		"3011" + "0c07622d6172726179" + "3006" + "0c0170" + "0c0171" +
+		"3012" + "0c06632d64696374" + "b008" + "3006" + "0c016b" + "010100" +
+		"300d" + "0c086d2d737472696e67" + "0c0178" +
+		"300b" + "0c067a2d626f6f6c" + "0101ff")
+	der, err := MarshalDerEntitlements(entitlements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(der, want) {
+		t.Errorf("got  %x\nwant %x", der, want)
+	}
+}
+
+func TestMarshalDerEntitlementsErrors(t *testing.T) {
+	tests := []struct {
+		body string
+		err  string
+	}{
+		{`<key>data</key><data>AAEC</data>`, `entitlement "data": <data> values are not supported`},
+		{`<key>date</key><date>2024-01-01T00:00:00Z</date>`, `entitlement "date": <date> values are not supported`},
+		{`<key>real</key><real>1.5</real>`, `entitlement "real": <real> values are not supported`},
+		{`<key>nested</key><dict><key>real</key><real>1.5</real></dict>`, `<real> values are not supported`},
+		{`<key>array</key><array><data>AAEC</data></array>`, `entitlement "array": <data> values are not supported`},
+	}
+	for _, test := range tests {
+		_, err := MarshalDerEntitlements(testEntitlementsPlist(t, test.body))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, got %v", test.body, test.err, err)
+		}
+	}
+}
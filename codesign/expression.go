@@ -2,6 +2,12 @@ package codesign
 
 import (
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // https://opensource.apple.com/source/libsecurity_codesigning/libsecurity_codesigning-55037.15/lib/requirement.h.auto.html
@@ -35,6 +41,8 @@ type RequirementExpression interface {
 	Load(buffer []byte)int
 	WriteBytes(buffer []byte)int
 	Length()int
+	// 要求语言的文本形式
+	String()string
 }
 
 func ExprReadData(buffer []byte)([]byte, int) {
@@ -100,6 +108,14 @@ func ReadExpression(buffer []byte)(RequirementExpression, int) {
 		v = new(CertificateGeneric)
 	case ExprAppleGenericAnchor:
 		v = new(AppleGenericAnchor)
+	case ExprEntitlementField:
+		v = new(EntitlementField)
+	case ExprCertPolicy:
+		v = new(CertificatePolicy)
+	case ExprNamedAnchor:
+		v = new(NamedAnchor)
+	case ExprNamedCode:
+		v = new(NamedCode)
 	}
 	if v == nil {
 		return nil, 0
@@ -107,3 +123,166 @@ func ReadExpression(buffer []byte)(RequirementExpression, int) {
 	n := v.Load(buffer)
 	return v, n
 }
+
+// 表达式嵌套的最大深度
+const maxExpressionDepth = 256
+
+var errTruncatedExpression = errors.New("requirement expression is truncated")
+
+// 检查表达式是否完整，返回表达式的长度
+// ReadExpression和各表达式的Load没有边界检查，解析不可信的数据前先检查
+func checkExpression(buffer []byte, depth int)(int, error) {
+	if depth > maxExpressionDepth {
+		return 0, errors.New("requirement expression is nested too deeply")
+	}
+	if len(buffer) < 4 {
+		return 0, errTruncatedExpression
+	}
+	switch binary.BigEndian.Uint32(buffer) {
+	case ExprFalse, ExprTrue, ExprAppleAnchor, ExprTrustedCertificates, ExprAppleGenericAnchor:
+		return 4, nil
+	case ExprIdent, ExprCodeDirectoryHash, ExprNamedAnchor, ExprNamedCode:
+		return checkExprData(buffer, 4)
+	case ExprAnchorHash:
+		return checkExprData(buffer, 8)
+	case ExprTrustedCertificate:
+		if len(buffer) < 8 {
+			return 0, errTruncatedExpression
+		}
+		return 8, nil
+	case ExprInfoKeyValue:
+		n, err := checkExprData(buffer, 4)
+		if err != nil {
+			return 0, err
+		}
+		return checkExprData(buffer, n)
+	case ExprInfoKeyField, ExprEntitlementField:
+		n, err := checkExprData(buffer, 4)
+		if err != nil {
+			return 0, err
+		}
+		return checkMatchSuffix(buffer, n)
+	case ExprCertificateField, ExprCertificateGeneric, ExprCertPolicy:
+		n, err := checkExprData(buffer, 8)
+		if err != nil {
+			return 0, err
+		}
+		return checkMatchSuffix(buffer, n)
+	case ExprNot:
+		n, err := checkExpression(buffer[4:], depth+1)
+		return 4 + n, err
+	case ExprAnd, ExprOr:
+		n1, err := checkExpression(buffer[4:], depth+1)
+		if err != nil {
+			return 0, err
+		}
+		n2, err := checkExpression(buffer[4+n1:], depth+1)
+		return 4 + n1 + n2, err
+	}
+	return 0, errors.New("unknown requirement expression opcode")
+}
+
+// 检查offset处的数据(长度和按4字节对齐的内容)，返回数据之后的偏移
+func checkExprData(buffer []byte, offset int)(int, error) {
+	if offset+4 > len(buffer) {
+		return 0, errTruncatedExpression
+	}
+	end := uint64(offset) + uint64(ExprDataLen(int(binary.BigEndian.Uint32(buffer[offset:]))))
+	if end > uint64(len(buffer)) {
+		return 0, errTruncatedExpression
+	}
+	return int(end), nil
+}
+
+func checkMatchSuffix(buffer []byte, offset int)(int, error) {
+	if offset+4 > len(buffer) {
+		return 0, errTruncatedExpression
+	}
+	if op := binary.BigEndian.Uint32(buffer[offset:]); op == MatchExists || op == MatchAbsent {
+		return offset + 4, nil
+	}
+	return checkExprData(buffer, offset+4)
+}
+
+// 输出文本时的优先级，低优先级的子表达式需要加括号
+const(
+	syntaxOr = iota
+	syntaxAnd
+	syntaxPrimary
+)
+
+func exprString(exp RequirementExpression, level int)string {
+	if exp == nil {
+		return "/* unknown */"
+	}
+	s := exp.String()
+	switch exp.(type) {
+	case *ExpressionOr:
+		if level > syntaxOr {
+			return "(" + s + ")"
+		}
+	case *ExpressionAnd:
+		if level > syntaxAnd {
+			return "(" + s + ")"
+		}
+	}
+	return s
+}
+
+func isPrintableData(data []byte)bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// 可以不加引号的字符串，如 subject.CN、CFBundleVersion
+func isSimpleWord(data []byte)bool {
+	if len(data) == 0 {
+		return false
+	}
+	for _, c := range data {
+		if !isWordChar(c) {
+			return false
+		}
+	}
+	word := string(data)
+	return !isRequirementKeyword(word)
+}
+
+func exprHashString(data []byte)string {
+	return "H\"" + hex.EncodeToString(data) + "\""
+}
+
+// 字符串值加引号，不可打印的数据输出为hex常量
+func exprValueString(data []byte)string {
+	if !isPrintableData(data) {
+		return exprHashString(data)
+	}
+	s := strings.Replace(string(data), "\\", "\\\\", -1)
+	return "\"" + strings.Replace(s, "\"", "\\\"", -1) + "\""
+}
+
+// 字典的key和证书字段名，简单的单词不加引号
+func exprKeyString(data []byte)string {
+	if isSimpleWord(data) {
+		return string(data)
+	}
+	return exprValueString(data)
+}
+
+// 证书在证书链中的位置，0为叶子证书，-1为根证书
+func certSlotString(slot uint32)string {
+	switch slot {
+	case LeafCertificate:
+		return "leaf"
+	case AnchorCertificate:
+		return "root"
+	}
+	return strconv.Itoa(int(int32(slot)))
+}
@@ -32,4 +32,8 @@ func(v *ExpressionAnd)GetBytes()[]byte{
 	buffer:= make([]byte, v.Length())
 	v.WriteBytes(buffer)
 	return buffer
-}
\ No newline at end of file
+}
+
+func(v *ExpressionAnd)String()string {
+	return exprString(v.Exp1, syntaxAnd) + " and " + exprString(v.Exp2, syntaxAnd)
+}
@@ -29,4 +29,8 @@ func(v *ExpressionNot)GetBytes()[]byte {
 	buffer := make([]byte, v.Length())
 	v.WriteBytes(buffer)
 	return buffer
-}
\ No newline at end of file
+}
+
+func(v *ExpressionNot)String()string {
+	return "! " + exprString(v.Exp1, syntaxPrimary)
+}
@@ -27,3 +27,7 @@ func(v *ExpressionOr)WriteBytes(buffer []byte)int {
 	n2 := v.Exp2.WriteBytes(buffer[4+n1:])
 	return 4 + n1 + n2
 }
+
+func(v *ExpressionOr)String()string {
+	return exprString(v.Exp1, syntaxOr) + " or " + exprString(v.Exp2, syntaxOr)
+}
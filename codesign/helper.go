@@ -3,6 +3,7 @@ package codesign
 import (
 	"crypto/x509"
 	"encoding/asn1"
+
 	"howett.net/plist"
 )
 
@@ -87,6 +88,22 @@ func CreateRequirements(ident, certificateCN string)*Requirements {
 	return codeRequirements
 }
 
+// ad-hoc签名隐含的指定要求：cdhash H"..."，用于CodeResources中嵌套代码的requirement
+func AdHocRequirement(cdHash []byte)*Requirement {
+	return &Requirement{
+		Kind:       RequirementKind,
+		Expression: &CodeDirectoryHash{Hash: cdHash},
+	}
+}
+
+// 签名使用的指定要求，options.DesignatedRequirement为空时使用CreateRequirements的默认要求
+func DesignatedRequirement(ident, certificateCN string, options *SignOptions)(*Requirement, error) {
+	if options == nil || options.DesignatedRequirement == "" {
+		return CreateRequirements(ident, certificateCN).Values[0], nil
+	}
+	return CompileRequirement(options.DesignatedRequirement)
+}
+
 func CreateEntitlements(entitlements EntitlementsFile)*Entitlements {
 	entitlementsBlob := NewEntitlements()
 	// XCode will remove the keychain-access-groups key from embedded entitlements
@@ -100,4 +117,15 @@ func CreateEntitlements(entitlements EntitlementsFile)*Entitlements {
 	}
 	entitlementsBlob.Data = data
 	return entitlementsBlob
-}
\ No newline at end of file
+}
+
+// entitlements的DER形式，iOS 15以上需要
+func CreateDerEntitlements(entitlements EntitlementsFile)(*DerEntitlements, error) {
+	data, err := MarshalDerEntitlements(entitlements)
+	if err != nil {
+		return nil, err
+	}
+	derEntitlementsBlob := NewDerEntitlements()
+	derEntitlementsBlob.Data = data
+	return derEntitlementsBlob, nil
+}
@@ -30,3 +30,7 @@ func(v *IdentValue)GetBytes()[]byte {
 	v.WriteBytes(buffer)
 	return buffer
 }
+
+func(v *IdentValue)String()string {
+	return "identifier " + exprValueString(v.Value)
+}
@@ -32,4 +32,8 @@ func(v *InfoKeyField)GetBytes()[]byte {
 	buffer := make([]byte, v.Length())
 	v.WriteBytes(buffer)
 	return buffer
-}
\ No newline at end of file
+}
+
+func(v *InfoKeyField)String()string {
+	return "info [" + exprKeyString(v.Key) + "]" + v.Match.String()
+}
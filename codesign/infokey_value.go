@@ -32,4 +32,8 @@ func(v *InfoKeyValue)GetBytes()[]byte {
 	buffer := make([]byte, v.Length())
 	v.WriteBytes(buffer)
 	return buffer
-}
\ No newline at end of file
+}
+
+func(v *InfoKeyValue)String()string {
+	return "info [" + exprKeyString(v.Key) + "] = " + exprValueString(v.Value)
+}
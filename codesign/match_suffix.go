@@ -1,6 +1,11 @@
 package codesign
 
-import "encoding/binary"
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
 
 const(
 	MatchExists = 0
@@ -12,6 +17,7 @@ const(
 	MatchGreaterThan = 6
 	MatchLessThanOrEqual = 7
 	MatchGreaterThanOrEqual = 8
+	MatchAbsent = 14 // 9-13为日期比较，不支持
 )
 
 type MatchSuffix struct {
@@ -19,8 +25,13 @@ type MatchSuffix struct {
 	MatchValue     []byte
 }
 
+// exists和absent之后没有值
+func(v *MatchSuffix)hasValue()bool {
+	return v.MatchOperation != MatchExists && v.MatchOperation != MatchAbsent
+}
+
 func(v *MatchSuffix)Length() int {
-	if v.MatchOperation == MatchExists{
+	if !v.hasValue() {
 		return 4
 	}
 	return  4 + ExprDataLen(len(v.MatchValue))
@@ -28,7 +39,7 @@ func(v *MatchSuffix)Length() int {
 
 func(v *MatchSuffix)Load(buffer []byte)int {
 	v.MatchOperation = binary.BigEndian.Uint32(buffer)
-	if v.MatchOperation == MatchExists {
+	if !v.hasValue() {
 		return 4
 	}
 	hash, n := ExprReadData(buffer[4:])
@@ -38,7 +49,7 @@ func(v *MatchSuffix)Load(buffer []byte)int {
 
 func(v *MatchSuffix)WriteBytes(buffer []byte)int {
 	binary.BigEndian.PutUint32(buffer, v.MatchOperation)
-	if v.MatchOperation == MatchExists {
+	if !v.hasValue() {
 		return 4
 	}
 	n := ExprWriteData(buffer[4:], v.MatchValue)
@@ -49,4 +60,129 @@ func(v *MatchSuffix)GetBytes()[]byte {
 	buffer := make([]byte, v.Length())
 	v.WriteBytes(buffer)
 	return buffer
-}
\ No newline at end of file
+}
+
+func(v *MatchSuffix)String()string {
+	switch v.MatchOperation {
+	case MatchExists:
+		return " /* exists */"
+	case MatchAbsent:
+		return " absent"
+	case MatchEqual:
+		return " = " + exprValueString(v.MatchValue)
+	case MatchContains:
+		return " ~ " + exprValueString(v.MatchValue)
+	case MatchBeginsWith:
+		return " = " + exprValueString(v.MatchValue) + "*"
+	case MatchEndsWith:
+		return " = *" + exprValueString(v.MatchValue)
+	case MatchLessThan:
+		return " < " + exprValueString(v.MatchValue)
+	case MatchGreaterThan:
+		return " > " + exprValueString(v.MatchValue)
+	case MatchLessThanOrEqual:
+		return " <= " + exprValueString(v.MatchValue)
+	case MatchGreaterThanOrEqual:
+		return " >= " + exprValueString(v.MatchValue)
+	}
+	return fmt.Sprintf(" /* unknown match %d */", v.MatchOperation)
+}
+
+// 判断值是否匹配，value为nil表示值不存在，数组中任意一个元素匹配即可
+func(v *MatchSuffix)Match(value interface{})bool {
+	if v.MatchOperation == MatchAbsent {
+		return value == nil
+	}
+	if value == nil {
+		return false
+	}
+	if v.MatchOperation == MatchExists {
+		return true
+	}
+	switch value := value.(type) {
+	case []interface{}:
+		for _, item := range value {
+			if v.Match(item) {
+				return true
+			}
+		}
+		return false
+	case []string:
+		for _, item := range value {
+			if v.Match(item) {
+				return true
+			}
+		}
+		return false
+	case []byte:
+		if v.MatchOperation == MatchEqual {
+			return bytes.Equal(value, v.MatchValue)
+		}
+		return v.matchString(string(value))
+	case string:
+		return v.matchString(value)
+	}
+	return v.matchString(fmt.Sprint(value))
+}
+
+func(v *MatchSuffix)matchString(value string)bool {
+	match := string(v.MatchValue)
+	switch v.MatchOperation {
+	case MatchEqual:
+		return value == match
+	case MatchContains:
+		return strings.Contains(value, match)
+	case MatchBeginsWith:
+		return strings.HasPrefix(value, match)
+	case MatchEndsWith:
+		return strings.HasSuffix(value, match)
+	case MatchLessThan:
+		return compareNumerically(value, match) < 0
+	case MatchGreaterThan:
+		return compareNumerically(value, match) > 0
+	case MatchLessThanOrEqual:
+		return compareNumerically(value, match) <= 0
+	case MatchGreaterThanOrEqual:
+		return compareNumerically(value, match) >= 0
+	}
+	return false
+}
+
+func isDigit(c byte)bool {
+	return c >= '0' && c <= '9'
+}
+
+// 数字部分按数值比较，如 "1.10" > "1.9"，同kCFCompareNumerically
+func compareNumerically(a, b string)int {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			i, j := 0, 0
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			na, nb := strings.TrimLeft(a[:i], "0"), strings.TrimLeft(b[:j], "0")
+			if len(na) != len(nb) {
+				if len(na) < len(nb) {
+					return -1
+				}
+				return 1
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+		if a[0] != b[0] {
+			if a[0] < b[0] {
+				return -1
+			}
+			return 1
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
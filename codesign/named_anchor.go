@@ -0,0 +1,71 @@
+package codesign
+
+import "encoding/binary"
+
+// anchor apple <name>
+type NamedAnchor struct {
+	Name []byte
+}
+
+func(v *NamedAnchor)Length() int {
+	return 4 + ExprDataLen(len(v.Name))
+}
+
+func(v *NamedAnchor)Load(buffer []byte)int {
+	if binary.BigEndian.Uint32(buffer) != ExprNamedAnchor {
+		return 0
+	}
+	data, n := ExprReadData(buffer[4:])
+	v.Name = data
+	return 4 + n
+}
+
+func(v *NamedAnchor)WriteBytes(buffer []byte)int {
+	binary.BigEndian.PutUint32(buffer, ExprNamedAnchor)
+	n := ExprWriteData(buffer[4:], v.Name)
+	return 4 + n
+}
+
+func(v *NamedAnchor)GetBytes()[]byte {
+	buffer := make([]byte, v.Length())
+	v.WriteBytes(buffer)
+	return buffer
+}
+
+func(v *NamedAnchor)String()string {
+	return "anchor apple " + exprKeyString(v.Name)
+}
+
+// 引用系统中命名的要求，只能解析和输出
+type NamedCode struct {
+	Name []byte
+}
+
+func(v *NamedCode)Length() int {
+	return 4 + ExprDataLen(len(v.Name))
+}
+
+func(v *NamedCode)Load(buffer []byte)int {
+	if binary.BigEndian.Uint32(buffer) != ExprNamedCode {
+		return 0
+	}
+	data, n := ExprReadData(buffer[4:])
+	v.Name = data
+	return 4 + n
+}
+
+func(v *NamedCode)WriteBytes(buffer []byte)int {
+	binary.BigEndian.PutUint32(buffer, ExprNamedCode)
+	n := ExprWriteData(buffer[4:], v.Name)
+	return 4 + n
+}
+
+func(v *NamedCode)GetBytes()[]byte {
+	buffer := make([]byte, v.Length())
+	v.WriteBytes(buffer)
+	return buffer
+}
+
+func(v *NamedCode)String()string {
+	return "(" + exprKeyString(v.Name) + ")"
+}
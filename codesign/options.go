@@ -0,0 +1,163 @@
+package codesign
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gamebtc/appsign/mach"
+)
+
+// 默认同时生成SHA-1和SHA-256的CodeDirectory，兼容旧版本的iOS
+var DefaultHashTypes = []byte{HashTypeSHA1, HashTypeSHA256}
+
+// 代码签名选项
+type SignOptions struct {
+	// CodeDirectory的hash类型，第一个写入CSSLOT_CODEDIRECTORY，其余写入CSSLOT_ALTERNATE_CODEDIRECTORIES
+	// 为空时使用DefaultHashTypes，iOS 15以上可以只使用HashTypeSHA256
+	HashTypes []byte
+	// 指定要求(designated requirement)的文本，为空时使用默认的要求：
+	// identifier "<bundle id>" and anchor apple generic and certificate leaf[subject.CN] = "<证书名称>" and ...
+	DesignatedRequirement string
+	// ad-hoc签名：不需要证书和私钥，CodeDirectory设置CS_ADHOC，没有team ID，CMS签名为空
+	// 没有指定DesignatedRequirement时不写入指定要求，系统使用隐含的 cdhash H"..." 要求
+	AdHoc bool
+	// CodeDirectory的标志，如CS_Runtime|CS_RequireLibraryValidation，可以用ParseCodeSignFlags解析
+	// 为nil时保留原签名中的标志，CS_Runtime时使用Mach-O的SDK版本作为hardened runtime的版本
+	Flags *uint32
+	// RFC 3161时间戳服务的地址，如AppleTimestampURL，为空时不添加时间戳，ad-hoc签名时忽略
+	TimestampURL string
+	// 请求时间戳的超时时间，为0时使用DefaultTimestampTimeout
+	TimestampTimeout time.Duration
+}
+
+func(o *SignOptions)adHoc()bool {
+	return o != nil && o.AdHoc
+}
+
+func(o *SignOptions)timestampURL()string {
+	if o == nil || o.AdHoc {
+		return ""
+	}
+	return o.TimestampURL
+}
+
+func(o *SignOptions)timestampTimeout()time.Duration {
+	if o == nil || o.TimestampTimeout <= 0 {
+		return DefaultTimestampTimeout
+	}
+	return o.TimestampTimeout
+}
+
+func(o *SignOptions)hashTypes()([]byte, error) {
+	if o == nil || len(o.HashTypes) == 0 {
+		return DefaultHashTypes, nil
+	}
+	if len(o.HashTypes) > CSSLOT_ALTERNATE_CODEDIRECTORY_MAX+1 {
+		return nil, errors.New("too many code directory hash types")
+	}
+	for i, hashType := range o.HashTypes {
+		if GetHashLength(hashType) == 0 {
+			return nil, errors.New("unsupported code directory hash type")
+		}
+		for _, other := range o.HashTypes[:i] {
+			if other == hashType {
+				return nil, errors.New("duplicate code directory hash type")
+			}
+		}
+	}
+	return o.HashTypes, nil
+}
+
+// 可以设置的CodeDirectory标志，同 codesign --options
+var codeSignFlagNames = []struct {
+	name string
+	flag uint32
+}{
+	{"host", CS_Host},
+	{"hard", CS_Hard},
+	{"kill", CS_Kill},
+	{"expires", CS_CheckExpiration},
+	{"restrict", CS_Restrict},
+	{"enforcement", CS_Enforcement},
+	{"library", CS_RequireLibraryValidation},
+	{"runtime", CS_Runtime},
+}
+
+// 重签名时保留的原签名标志
+const CodeSignFlagsMask = CS_Host | CS_Hard | CS_Kill | CS_CheckExpiration | CS_Restrict | CS_Enforcement |
+	CS_RequireLibraryValidation | CS_Runtime
+
+// 解析逗号分隔的标志名称，如 runtime,library，也可以是十六进制的数值如 0x10000
+func ParseCodeSignFlags(text string)(uint32, error) {
+	var flags uint32
+	for _, name := range strings.Split(text, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || name == "none" {
+			continue
+		}
+		if value, err := strconv.ParseUint(name, 0, 32); err == nil {
+			flags |= uint32(value)
+			continue
+		}
+		found := false
+		for _, item := range codeSignFlagNames {
+			if item.name == name {
+				flags |= item.flag
+				found = true
+			}
+		}
+		if !found {
+			return 0, errors.New("unknown code signing option: " + name)
+		}
+	}
+	return flags, nil
+}
+
+// 标志的名称，如 kill,hard,runtime
+func CodeSignFlagsString(flags uint32)string {
+	var names []string
+	for _, item := range codeSignFlagNames {
+		if flags&item.flag != 0 {
+			names = append(names, item.name)
+			flags &^= item.flag
+		}
+	}
+	if flags != 0 {
+		names = append(names, "0x"+strconv.FormatUint(uint64(flags), 16))
+	}
+	return strings.Join(names, ",")
+}
+
+// 检查标志的组合，ad-hoc签名没有证书和team ID
+func validateCodeSignFlags(flags uint32, adHoc bool)error {
+	if flags&^CodeSignFlagsMask != 0 {
+		return errors.New("unsupported code signing flags: " + CodeSignFlagsString(flags&^CodeSignFlagsMask))
+	}
+	if adHoc && flags&CS_CheckExpiration != 0 {
+		return errors.New("expires cannot be used with an ad-hoc signature")
+	}
+	if adHoc && flags&CS_RequireLibraryValidation != 0 {
+		return errors.New("library validation requires a team identifier and cannot be used with an ad-hoc signature")
+	}
+	return nil
+}
+
+// 签名使用的标志，Flags为nil时使用原签名中的标志，未签名的文件没有标志
+func(o *SignOptions)codeSignFlags(file *mach.MachObjectFile)(uint32, error) {
+	var flags uint32
+	if o != nil && o.Flags != nil {
+		flags = *o.Flags
+	} else if signature, err := ParseEmbeddedSignature(file); err == nil {
+		flags = signature.CodeDirectories[0].Flags & CodeSignFlagsMask
+		if o.adHoc() {
+			// 改为ad-hoc签名时去掉需要证书的标志
+			flags &^= CS_CheckExpiration | CS_RequireLibraryValidation
+		}
+	}
+	if err := validateCodeSignFlags(flags, o.adHoc()); err != nil {
+		return 0, err
+	}
+	return flags, nil
+}
@@ -1,6 +1,9 @@
 package codesign
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"errors"
+)
 
 const(
 	HostRequirementType = 0x00000001       // kSecHostRequirementType
@@ -113,4 +116,33 @@ func(c *Requirements)Length()int {
 func(c *Requirements)Add(k uint32, v *Requirement) {
 	c.Keys = append(c.Keys, k)
 	c.Values = append(c.Values, v)
-}
\ No newline at end of file
+}
+// 检查要求blob的结构，Load之前调用
+func checkRequirement(blob []byte)error {
+	if len(blob) < 12 || binary.BigEndian.Uint32(blob) != CSMAGIC_REQUIREMENT {
+		return errors.New("invalid requirement blob")
+	}
+	_, err := checkExpression(blob[12:], 0)
+	return err
+}
+
+// 检查要求集合的索引和其中每个要求，Load之前调用
+func checkRequirements(blob []byte)error {
+	if len(blob) < RequirementsSize || binary.BigEndian.Uint32(blob) != CSMAGIC_REQUIREMENTS {
+		return errors.New("invalid requirements blob")
+	}
+	count := binary.BigEndian.Uint32(blob[8:])
+	if uint64(RequirementsSize)+uint64(count)*8 > uint64(len(blob)) {
+		return errors.New("requirements index is truncated")
+	}
+	for i := uint32(0); i < count; i++ {
+		raw, err := readBlob(blob, binary.BigEndian.Uint32(blob[RequirementsSize+i*8+4:]))
+		if err != nil {
+			return err
+		}
+		if err := checkRequirement(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
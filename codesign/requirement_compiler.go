@@ -0,0 +1,523 @@
+package codesign
+
+import (
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 证书在证书链中的位置
+const(
+	LeafCertificate   = 0          // 叶子证书(签名证书)
+	AnchorCertificate = 0xffffffff // 根证书(-1)
+)
+
+// 要求集合中每种要求的名称，如 designated => identifier "com.example"
+var requirementTypeNames = map[uint32]string{
+	HostRequirementType:       "host",
+	GuestRequirementType:      "guest",
+	DesignatedRequirementType: "designated",
+	LibraryRequirementType:    "library",
+	PluginRequirementType:     "plugin",
+}
+
+func isWordChar(c byte)bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-'
+}
+
+func isRequirementKeyword(word string)bool {
+	return word == "and" || word == "or"
+}
+
+// OID的DER内容编码，如 1.2.840.113635.100.6.2.1
+func encodeOid(text string)([]byte, error) {
+	var oid asn1.ObjectIdentifier
+	for _, part := range strings.Split(text, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid oid %q", text)
+		}
+		oid = append(oid, n)
+	}
+	data := encodedOid(oid)
+	if data == nil {
+		return nil, fmt.Errorf("invalid oid %q", text)
+	}
+	return data, nil
+}
+
+func encodedOid(oid asn1.ObjectIdentifier)[]byte {
+	der, err := asn1.Marshal(oid)
+	if err != nil {
+		return nil
+	}
+	var raw asn1.RawValue
+	if _, err = asn1.Unmarshal(der, &raw); err != nil {
+		return nil
+	}
+	return raw.Bytes
+}
+
+func oidString(data []byte)string {
+	der, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagOID, Bytes: data})
+	if err == nil {
+		var oid asn1.ObjectIdentifier
+		if _, err = asn1.Unmarshal(der, &oid); err == nil {
+			return oid.String()
+		}
+	}
+	return exprHashString(data)
+}
+
+// 要求的文本形式，与Apple的csreq输出一致
+func(c *Requirement)String()string {
+	return exprString(c.Expression, syntaxOr)
+}
+
+// 每行一个要求，如 designated => identifier "com.example" and anchor apple generic
+func(c *Requirements)String()string {
+	lines := make([]string, len(c.Keys))
+	for i, key := range c.Keys {
+		name, ok := requirementTypeNames[key]
+		if !ok {
+			name = strconv.Itoa(int(key))
+		}
+		lines[i] = name + " => " + c.Values[i].String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// 编译Apple的代码要求语言，如
+// identifier "com.example" and anchor apple generic and certificate leaf[subject.CN] = "iPhone Distribution: Example"
+func CompileRequirement(text string)(*Requirement, error) {
+	p, err := newRequirementParser(text)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if !p.atEnd() {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+	return &Requirement{Kind: RequirementKind, Expression: exp}, nil
+}
+
+// 编译要求集合，每个要求以类型开头，如
+// designated => identifier "com.example" library => anchor apple
+func CompileRequirements(text string)(*Requirements, error) {
+	p, err := newRequirementParser(text)
+	if err != nil {
+		return nil, err
+	}
+	requirements := new(Requirements)
+	for !p.atEnd() {
+		name := p.next()
+		var kind uint32
+		for key, typeName := range requirementTypeNames {
+			if typeName == name.text {
+				kind = key
+			}
+		}
+		if kind == 0 || name.kind != tokenWord {
+			return nil, p.errorf("unknown requirement type %q", name.text)
+		}
+		if err = p.expect("=>"); err != nil {
+			return nil, err
+		}
+		exp, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		requirements.Add(kind, &Requirement{Kind: RequirementKind, Expression: exp})
+	}
+	return requirements, nil
+}
+
+const(
+	tokenEnd = iota
+	tokenWord     // 单词或数字，如 identifier、subject.CN、-1
+	tokenString   // 带引号的字符串
+	tokenHash     // hex常量 H"..."
+	tokenOperator // 运算符和括号
+)
+
+type requirementToken struct {
+	kind   int
+	text   string
+	data   []byte
+	offset int
+}
+
+type requirementParser struct {
+	tokens []requirementToken
+	pos    int
+}
+
+var requirementOperators = []string{"=>", "==", "<=", ">=", "=", "<", ">", "~", "!", "(", ")", "[", "]", "*"}
+
+func newRequirementParser(text string)(*requirementParser, error) {
+	p := new(requirementParser)
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("requirement: unterminated comment at offset %d", i)
+			}
+			i += end + 4
+		case strings.HasPrefix(text[i:], "//") || c == '#':
+			end := strings.IndexByte(text[i:], '\n')
+			if end < 0 {
+				end = len(text) - i
+			}
+			i += end
+		case c == '"' || c == 'H' && i+1 < len(text) && text[i+1] == '"':
+			start := i
+			if c == 'H' {
+				i++
+			}
+			var value []byte
+			for i++; i < len(text) && text[i] != '"'; i++ {
+				if text[i] == '\\' && i+1 < len(text) {
+					i++
+				}
+				value = append(value, text[i])
+			}
+			if i >= len(text) {
+				return nil, fmt.Errorf("requirement: unterminated string at offset %d", start)
+			}
+			i++
+			token := requirementToken{kind: tokenString, text: text[start:i], data: value, offset: start}
+			if c == 'H' {
+				data, err := hex.DecodeString(string(value))
+				if err != nil {
+					return nil, fmt.Errorf("requirement: invalid hex constant at offset %d", start)
+				}
+				token.kind, token.data = tokenHash, data
+			}
+			p.tokens = append(p.tokens, token)
+		case isWordChar(c):
+			start := i
+			for i < len(text) && isWordChar(text[i]) {
+				i++
+			}
+			p.tokens = append(p.tokens, requirementToken{kind: tokenWord, text: text[start:i], data: []byte(text[start:i]), offset: start})
+		default:
+			operator := ""
+			for _, op := range requirementOperators {
+				if strings.HasPrefix(text[i:], op) {
+					operator = op
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("requirement: unexpected character %q at offset %d", c, i)
+			}
+			p.tokens = append(p.tokens, requirementToken{kind: tokenOperator, text: operator, offset: i})
+			i += len(operator)
+		}
+	}
+	p.tokens = append(p.tokens, requirementToken{kind: tokenEnd, offset: len(text)})
+	return p, nil
+}
+
+func(p *requirementParser)peek()requirementToken {
+	return p.tokens[p.pos]
+}
+
+func(p *requirementParser)next()requirementToken {
+	token := p.tokens[p.pos]
+	if token.kind != tokenEnd {
+		p.pos++
+	}
+	return token
+}
+
+func(p *requirementParser)atEnd()bool {
+	return p.peek().kind == tokenEnd
+}
+
+// 下一个是指定的单词或运算符时跳过并返回true
+func(p *requirementParser)accept(text string)bool {
+	token := p.peek()
+	if (token.kind == tokenWord || token.kind == tokenOperator) && token.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func(p *requirementParser)expect(text string)error {
+	if !p.accept(text) {
+		return p.errorf("expected %q", text)
+	}
+	return nil
+}
+
+func(p *requirementParser)errorf(format string, args ...interface{})error {
+	token := p.peek()
+	if token.kind == tokenEnd {
+		return fmt.Errorf("requirement: "+format+" at end of input", args...)
+	}
+	return fmt.Errorf("requirement: "+format+" at offset %d", append(args, token.offset)...)
+}
+
+// expr: term ("or" term)*
+func(p *requirementParser)expression()(RequirementExpression, error) {
+	exp, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		exp = &ExpressionOr{Exp1: exp, Exp2: right}
+	}
+	return exp, nil
+}
+
+// term: primary ("and" primary)*
+func(p *requirementParser)term()(RequirementExpression, error) {
+	exp, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		exp = &ExpressionAnd{Exp1: exp, Exp2: right}
+	}
+	return exp, nil
+}
+
+func(p *requirementParser)primary()(RequirementExpression, error) {
+	if p.accept("!") {
+		exp, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		return &ExpressionNot{Exp1: exp}, nil
+	}
+	if p.accept("(") {
+		exp, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		return exp, p.expect(")")
+	}
+	token := p.peek()
+	if token.kind == tokenEnd {
+		return nil, p.errorf("expected a requirement")
+	}
+	if token.kind != tokenWord {
+		return nil, p.errorf("unexpected %q", token.text)
+	}
+	p.pos++
+	switch token.text {
+	case "always", "true":
+		return new(BooleanTrue), nil
+	case "never", "false":
+		return new(BooleanFalse), nil
+	case "identifier":
+		p.acceptEqual()
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return &IdentValue{Value: value}, nil
+	case "cdhash":
+		p.acceptEqual()
+		hash, err := p.hash()
+		if err != nil {
+			return nil, err
+		}
+		return &CodeDirectoryHash{Hash: hash}, nil
+	case "anchor":
+		if p.accept("apple") {
+			if p.accept("generic") {
+				return new(AppleGenericAnchor), nil
+			}
+			// 要求集合中下一个要求的类型不是名称，如 anchor apple library => ...
+			next := p.peek()
+			if (next.kind == tokenWord && !isRequirementKeyword(next.text) || next.kind == tokenString) && p.tokens[p.pos+1].text != "=>" {
+				p.pos++
+				return &NamedAnchor{Name: next.data}, nil
+			}
+			return new(AppleAnchor), nil
+		}
+		if p.accept("trusted") {
+			return new(TrustedCertificates), nil
+		}
+		return p.certificate(AnchorCertificate)
+	case "certificate", "cert":
+		slot, err := p.certSlot()
+		if err != nil {
+			return nil, err
+		}
+		return p.certificate(slot)
+	case "info":
+		key, match, err := p.keyMatch()
+		if err != nil {
+			return nil, err
+		}
+		return &InfoKeyField{Key: key, Match: match}, nil
+	case "entitlement":
+		key, match, err := p.keyMatch()
+		if err != nil {
+			return nil, err
+		}
+		return &EntitlementField{Key: key, Match: match}, nil
+	}
+	p.pos--
+	return nil, p.errorf("unknown requirement %q", token.text)
+}
+
+func(p *requirementParser)acceptEqual()bool {
+	return p.accept("=") || p.accept("==")
+}
+
+// leaf、root、anchor或证书位置(负数从根证书开始计算)
+func(p *requirementParser)certSlot()(uint32, error) {
+	token := p.peek()
+	switch token.text {
+	case "leaf":
+		p.pos++
+		return LeafCertificate, nil
+	case "root", "anchor":
+		p.pos++
+		return AnchorCertificate, nil
+	}
+	slot, err := strconv.ParseInt(token.text, 10, 32)
+	if token.kind != tokenWord || err != nil {
+		return 0, p.errorf("expected certificate position")
+	}
+	p.pos++
+	return uint32(int32(slot)), nil
+}
+
+// certificate <slot> 之后的部分
+func(p *requirementParser)certificate(slot uint32)(RequirementExpression, error) {
+	if p.accept("trusted") {
+		return &TrustedCertificate{CertificateIndex: slot}, nil
+	}
+	if p.acceptEqual() {
+		hash, err := p.hash()
+		if err != nil {
+			return nil, err
+		}
+		return &AnchorHash{Slot: slot, Hash: hash}, nil
+	}
+	fieldPos := p.pos + 1
+	field, match, err := p.keyMatch()
+	if err != nil {
+		return nil, err
+	}
+	name := string(field)
+	switch {
+	case strings.HasPrefix(name, "field."):
+		oid, err := encodeOid(name[len("field."):])
+		if err != nil {
+			p.pos = fieldPos
+			return nil, p.errorf("%v", err)
+		}
+		return &CertificateGeneric{CertificateIndex: slot, Oid: oid, Match: match}, nil
+	case strings.HasPrefix(name, "policy."):
+		oid, err := encodeOid(name[len("policy."):])
+		if err != nil {
+			p.pos = fieldPos
+			return nil, p.errorf("%v", err)
+		}
+		return &CertificatePolicy{CertificateIndex: slot, Oid: oid, Match: match}, nil
+	}
+	return &CertificateField{CertificateIndex: slot, FieldName: field, Match: match}, nil
+}
+
+// [key] match
+func(p *requirementParser)keyMatch()([]byte, MatchSuffix, error) {
+	var match MatchSuffix
+	if err := p.expect("["); err != nil {
+		return nil, match, err
+	}
+	key, err := p.value()
+	if err != nil {
+		return nil, match, err
+	}
+	if err = p.expect("]"); err != nil {
+		return nil, match, err
+	}
+	match, err = p.match()
+	return key, match, err
+}
+
+// = value、= *value、= value*、= *value*、~ value、< value、absent等，没有时为exists
+func(p *requirementParser)match()(MatchSuffix, error) {
+	var match MatchSuffix
+	var err error
+	switch {
+	case p.acceptEqual():
+		match.MatchOperation = MatchEqual
+		if p.accept("*") {
+			match.MatchOperation = MatchEndsWith
+		}
+		if match.MatchValue, err = p.value(); err != nil {
+			return match, err
+		}
+		if p.accept("*") {
+			if match.MatchOperation == MatchEndsWith {
+				match.MatchOperation = MatchContains
+			} else {
+				match.MatchOperation = MatchBeginsWith
+			}
+		}
+		return match, nil
+	case p.accept("~"):
+		match.MatchOperation = MatchContains
+	case p.accept("<="):
+		match.MatchOperation = MatchLessThanOrEqual
+	case p.accept(">="):
+		match.MatchOperation = MatchGreaterThanOrEqual
+	case p.accept("<"):
+		match.MatchOperation = MatchLessThan
+	case p.accept(">"):
+		match.MatchOperation = MatchGreaterThan
+	case p.accept("absent"):
+		match.MatchOperation = MatchAbsent
+		return match, nil
+	default:
+		p.accept("exists")
+		match.MatchOperation = MatchExists
+		return match, nil
+	}
+	match.MatchValue, err = p.value()
+	return match, err
+}
+
+// 字符串、单词或hex常量
+func(p *requirementParser)value()([]byte, error) {
+	token := p.peek()
+	if token.kind == tokenString || token.kind == tokenHash || token.kind == tokenWord && !isRequirementKeyword(token.text) {
+		p.pos++
+		return token.data, nil
+	}
+	return nil, p.errorf("expected a string")
+}
+
+func(p *requirementParser)hash()([]byte, error) {
+	token := p.peek()
+	if token.kind != tokenHash {
+		return nil, p.errorf("expected a hex constant H\"...\"")
+	}
+	p.pos++
+	return token.data, nil
+}
@@ -0,0 +1,139 @@
+package codesign
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompileRequirement(t *testing.T) {
+	tests := []struct {
+		text string
+		want string // String()的结果，为空时与text相同
+	}{
+		{text: `identifier "com.example.app" and anchor apple generic and certificate leaf[subject.CN] = "Apple Development: Test (TEAMID1234)" and certificate 1[field.1.2.840.113635.100.6.2.1] /* exists */`},
+		{text: `anchor apple generic`},
+		{text: `anchor apple`},
+		{text: `anchor trusted`},
+		{text: `always`},
+		{text: `never`},
+		{text: `identifier com.example.app`, want: `identifier "com.example.app"`},
+		{text: `identifier "a \"quoted\" name"`},
+		{text: `certificate root = H"0123456789abcdef0123456789abcdef01234567"`},
+		{text: `anchor = H"0123456789abcdef0123456789abcdef01234567"`, want: `certificate root = H"0123456789abcdef0123456789abcdef01234567"`},
+		{text: `certificate leaf[subject.OU] = TEAMID1234`, want: `certificate leaf[subject.OU] = "TEAMID1234"`},
+		{text: `cert -1[subject.O] = "Apple Inc."`, want: `certificate root[subject.O] = "Apple Inc."`},
+		{text: `certificate 2[issuer.CN] = "Apple Root CA"`},
+		{text: `certificate -2[subject.CN] ~ WWDR`, want: `certificate -2[subject.CN] ~ "WWDR"`},
+		{text: `certificate 1[field.1.2.840.113635.100.6.2.1] exists`, want: `certificate 1[field.1.2.840.113635.100.6.2.1] /* exists */`},
+		{text: `certificate leaf[field.1.2.840.113635.100.6.1.2] absent`},
+		{text: `certificate leaf[policy.1.2.840.113635.100.5.1] exists`, want: `certificate leaf[policy.1.2.840.113635.100.5.1] /* exists */`},
+		{text: `info[CFBundleVersion] >= "1.0"`, want: `info [CFBundleVersion] >= "1.0"`},
+		{text: `info [CFBundleShortVersionString] < "2.10"`},
+		{text: `info [CFBundleVersion] > "3"`},
+		{text: `info [CFBundleVersion] <= "3"`},
+		{text: `info [LSUIElement] absent`},
+		{text: `entitlement["get-task-allow"] exists`, want: `entitlement [get-task-allow] /* exists */`},
+		{text: `entitlement ["com.apple.developer.team-identifier"] = TEAMID1234`, want: `entitlement [com.apple.developer.team-identifier] = "TEAMID1234"`},
+		{text: `info[CFBundleIdentifier] = com.example.*`, want: `info [CFBundleIdentifier] = "com.example."*`},
+		{text: `info[CFBundleIdentifier] = *.app`, want: `info [CFBundleIdentifier] = *".app"`},
+		{text: `info[CFBundleIdentifier] = *example*`, want: `info [CFBundleIdentifier] ~ "example"`},
+		{text: `cdhash H"0123456789abcdef0123456789abcdef01234567"`},
+		// !优先于and，and优先于or
+		{text: `! identifier a or identifier b and identifier c`, want: `! identifier "a" or identifier "b" and identifier "c"`},
+		{text: `!(identifier a or identifier b) and identifier c`, want: `! (identifier "a" or identifier "b") and identifier "c"`},
+		{text: `(identifier a or identifier b) and (identifier c or identifier d)`, want: `(identifier "a" or identifier "b") and (identifier "c" or identifier "d")`},
+		{text: `((identifier a and identifier b)) or identifier c`, want: `identifier "a" and identifier "b" or identifier "c"`},
+		{text: "identifier a // comment\n and /* inline */ anchor apple # comment", want: `identifier "a" and anchor apple`},
+	}
+	for _, test := range tests {
+		requirement, err := CompileRequirement(test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+			continue
+		}
+		want := test.want
+		if want == "" {
+			want = test.text
+		}
+		text := requirement.String()
+		if text != want {
+			t.Errorf("%s:\n got %s\nwant %s", test.text, text, want)
+		}
+		again, err := CompileRequirement(text)
+		if err != nil {
+			t.Errorf("%s: cannot compile the printed requirement: %v", test.text, err)
+			continue
+		}
+		if !bytes.Equal(again.GetBytes(), requirement.GetBytes()) || again.String() != text {
+			t.Errorf("%s: requirement changed after compile, print and compile", test.text)
+		}
+		read, n := ReadRequirement(requirement.GetBytes())
+		if read == nil || n != requirement.Length() || read.String() != text {
+			t.Errorf("%s: binary requirement did not round-trip", test.text)
+		}
+	}
+}
+
+func TestCompileRequirementErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		err  string
+	}{
+		{``, "expected a requirement at end of input"},
+		{`identifier`, "expected a string"},
+		{`identifier "a" and`, "expected a requirement"},
+		{`identifier a or or identifier b`, `unknown requirement "or" at offset 16`},
+		{`(identifier a`, `expected ")"`},
+		{`anchor apple generic)`, `unexpected ")" at offset 20`},
+		{`certificate leaf[subject.CN = "x"`, `expected "]"`},
+		{`certificate x[subject.CN] = a`, "expected certificate position at offset 12"},
+		{`certificate leaf[field.1.x] exists`, `invalid oid "1.x" at offset 17`},
+		{`cdhash "abc"`, "expected a hex constant"},
+		{`cdhash H"0g"`, "invalid hex constant at offset 7"},
+		{`info[a] = "x`, "unterminated string at offset 10"},
+		{`identifier a /* comment`, "unterminated comment"},
+		{`identifier a & anchor apple`, `unexpected character '&'`},
+		{`frobnicate`, `unknown requirement "frobnicate" at offset 0`},
+		{`designated => anchor apple`, `unknown requirement "designated"`},
+	}
+	for _, test := range tests {
+		_, err := CompileRequirement(test.text)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected error containing %q, got %v", test.text, test.err, err)
+		}
+	}
+}
+
+func TestCompileRequirements(t *testing.T) {
+	text := `designated => identifier "com.example.app" and anchor apple generic
+library => anchor apple or anchor = H"0123456789abcdef0123456789abcdef01234567"
+host => anchor apple generic and info [CFBundleIdentifier] = "com.example.host"`
+	want := `designated => identifier "com.example.app" and anchor apple generic
+library => anchor apple or certificate root = H"0123456789abcdef0123456789abcdef01234567"
+host => anchor apple generic and info [CFBundleIdentifier] = "com.example.host"`
+	requirements, err := CompileRequirements(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requirements.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", requirements.String(), want)
+	}
+	if len(requirements.Keys) != 3 || requirements.Keys[0] != DesignatedRequirementType ||
+		requirements.Keys[1] != LibraryRequirementType || requirements.Keys[2] != HostRequirementType {
+		t.Errorf("unexpected requirement types %v", requirements.Keys)
+	}
+	again, err := CompileRequirements(requirements.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.GetBytes(), requirements.GetBytes()) {
+		t.Errorf("requirement set changed after compile, print and compile")
+	}
+
+	for _, text := range []string{`designated identifier a`, `unknown => anchor apple`, `designated => `} {
+		if _, err := CompileRequirements(text); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
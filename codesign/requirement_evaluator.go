@@ -0,0 +1,185 @@
+package codesign
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 要求求值所需的签名信息
+type RequirementContext struct {
+	Certificates []*x509.Certificate // 签名证书链，第一个为叶子证书，最后一个为根证书
+	AppleAnchors []*x509.Certificate // Apple的根证书，用于anchor apple和anchor apple generic
+	Identifier   string              // CodeDirectory中的标识符
+	InfoFile     map[string]interface{}
+	Entitlements EntitlementsFile
+	CDHashes     [][]byte // 所有CodeDirectory的cdhash，任意一个匹配cdhash要求即可
+}
+
+// 证书名称中的字段，如 subject.CN、issuer.O
+var certificateNameOIDs = map[string]asn1.ObjectIdentifier{
+	"CN":     X509CertificateCommonNameOID,
+	"C":      {2, 5, 4, 6},
+	"L":      {2, 5, 4, 7},
+	"ST":     {2, 5, 4, 8},
+	"STREET": {2, 5, 4, 9},
+	"O":      {2, 5, 4, 10},
+	"OU":     X509CertificateOrganizationalUnitOID,
+	"UID":    X509CertificateUserOID,
+	"email":  {1, 2, 840, 113549, 1, 9, 1},
+}
+
+// Apple自己的产品使用的签名证书
+const appleSoftwareSigningCN = "Software Signing"
+
+// 判断签名是否满足要求
+func(c *Requirement)Evaluate(ctx *RequirementContext)(bool, error) {
+	return EvaluateExpression(c.Expression, ctx)
+}
+
+// 对要求表达式求值，不支持的表达式(如需要系统信任设置的anchor trusted)返回错误
+func EvaluateExpression(exp RequirementExpression, ctx *RequirementContext)(bool, error) {
+	switch v := exp.(type) {
+	case *BooleanFalse:
+		return false, nil
+	case *BooleanTrue:
+		return true, nil
+	case *IdentValue:
+		return ctx.Identifier == string(v.Value), nil
+	case *AppleAnchor:
+		leaf := ctx.certificate(LeafCertificate)
+		return ctx.isAppleAnchored() && leaf != nil && leaf.Subject.CommonName == appleSoftwareSigningCN, nil
+	case *AppleGenericAnchor:
+		return ctx.isAppleAnchored(), nil
+	case *AnchorHash:
+		cert := ctx.certificate(v.Slot)
+		if cert == nil {
+			return false, nil
+		}
+		hash := sha1.Sum(cert.Raw)
+		return bytes.Equal(hash[:], v.Hash), nil
+	case *InfoKeyValue:
+		value, ok := ctx.InfoFile[string(v.Key)].(string)
+		return ok && value == string(v.Value), nil
+	case *ExpressionAnd:
+		ok, err := EvaluateExpression(v.Exp1, ctx)
+		if err != nil || !ok {
+			return false, err
+		}
+		return EvaluateExpression(v.Exp2, ctx)
+	case *ExpressionOr:
+		ok, err := EvaluateExpression(v.Exp1, ctx)
+		if err != nil || ok {
+			return ok, err
+		}
+		return EvaluateExpression(v.Exp2, ctx)
+	case *CodeDirectoryHash:
+		for _, cdHash := range ctx.CDHashes {
+			if bytes.Equal(cdHash, v.Hash) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case *ExpressionNot:
+		ok, err := EvaluateExpression(v.Exp1, ctx)
+		return !ok && err == nil, err
+	case *InfoKeyField:
+		return v.Match.Match(ctx.InfoFile[string(v.Key)]), nil
+	case *EntitlementField:
+		return v.Match.Match(ctx.Entitlements[string(v.Key)]), nil
+	case *CertificateField:
+		return v.Match.Match(certificateFieldValue(ctx.certificate(v.CertificateIndex), string(v.FieldName))), nil
+	case *CertificateGeneric:
+		cert := ctx.certificate(v.CertificateIndex)
+		if cert == nil {
+			return false, nil
+		}
+		for _, ext := range cert.Extensions {
+			if bytes.Equal(encodedOid(ext.Id), v.Oid) {
+				return v.Match.Match(ext.Value), nil
+			}
+		}
+		return v.Match.Match(nil), nil
+	case *CertificatePolicy:
+		// 只能判断证书是否包含该策略，不支持与策略限定符比较
+		if v.Match.MatchOperation != MatchExists && v.Match.MatchOperation != MatchAbsent {
+			return false, fmt.Errorf("unsupported certificate policy match: %s", exp)
+		}
+		cert := ctx.certificate(v.CertificateIndex)
+		if cert == nil {
+			return false, nil
+		}
+		for _, policy := range cert.PolicyIdentifiers {
+			if bytes.Equal(encodedOid(policy), v.Oid) {
+				return v.Match.MatchOperation == MatchExists, nil
+			}
+		}
+		return v.Match.MatchOperation == MatchAbsent, nil
+	case nil:
+		return false, errors.New("invalid requirement expression")
+	}
+	return false, fmt.Errorf("unsupported requirement: %s", exp)
+}
+
+// 证书链中的证书，slot为负数时从根证书开始计算，不存在时返回nil
+func(ctx *RequirementContext)certificate(slot uint32)*x509.Certificate {
+	index := int(int32(slot))
+	if index < 0 {
+		index += len(ctx.Certificates)
+	}
+	if index < 0 || index >= len(ctx.Certificates) {
+		return nil
+	}
+	return ctx.Certificates[index]
+}
+
+func(ctx *RequirementContext)isAppleAnchored()bool {
+	anchor := ctx.certificate(AnchorCertificate)
+	if anchor == nil {
+		return false
+	}
+	for _, apple := range ctx.AppleAnchors {
+		if bytes.Equal(apple.Raw, anchor.Raw) {
+			return true
+		}
+	}
+	return false
+}
+
+// subject.CN、issuer.O 等字段的值，证书或字段不存在时返回nil
+func certificateFieldValue(cert *x509.Certificate, field string)interface{} {
+	if cert == nil {
+		return nil
+	}
+	i := strings.Index(field, ".")
+	if i < 0 {
+		return nil
+	}
+	oid, ok := certificateNameOIDs[field[i+1:]]
+	if !ok {
+		return nil
+	}
+	var names []interface{}
+	switch field[:i] {
+	case "subject":
+		for _, name := range cert.Subject.Names {
+			if name.Type.Equal(oid) {
+				names = append(names, name.Value)
+			}
+		}
+	case "issuer":
+		for _, name := range cert.Issuer.Names {
+			if name.Type.Equal(oid) {
+				names = append(names, name.Value)
+			}
+		}
+	}
+	if names == nil {
+		return nil
+	}
+	return names
+}
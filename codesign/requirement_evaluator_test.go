@@ -0,0 +1,210 @@
+package codesign
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testDevelopmentOID = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 1, 2}
+	testApplePolicyOID = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 5, 1}
+)
+
+// 测试用的证书链：叶子证书、中间证书和根证书(顺序同RequirementContext.Certificates)，
+// 叶子证书带有开发证书扩展和Apple证书策略
+func testRequirementChain(t *testing.T, leafCN string)[]*x509.Certificate {
+	policies, err := asn1.Marshal([]struct{ Policy asn1.ObjectIdentifier }{{testApplePolicyOID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := []*x509.Certificate{
+		{Subject: pkix.Name{CommonName: "Test Root CA", Organization: []string{"Apple Inc."}}},
+		{Subject: pkix.Name{CommonName: "Apple Worldwide Developer Relations Certification Authority",
+			Organization: []string{"Apple Inc."}}},
+		{Subject: pkix.Name{CommonName: leafCN, OrganizationalUnit: []string{"TEAMID1234"}},
+			ExtraExtensions: []pkix.Extension{
+				{Id: testDevelopmentOID, Value: []byte{5, 0}},
+				{Id: asn1.ObjectIdentifier{2, 5, 29, 32}, Value: policies},
+			}},
+	}
+	var chain []*x509.Certificate
+	var parent *x509.Certificate
+	var parentKey *ecdsa.PrivateKey
+	for i, template := range templates {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template.SerialNumber = big.NewInt(int64(i + 1))
+		template.NotBefore = time.Now().Add(-time.Hour)
+		template.NotAfter = time.Now().Add(time.Hour)
+		template.BasicConstraintsValid = true
+		template.IsCA = i < len(templates)-1
+		if parent == nil {
+			parent, parentKey = template, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append([]*x509.Certificate{cert}, chain...)
+		parent, parentKey = cert, key
+	}
+	return chain
+}
+
+func TestEvaluateRequirement(t *testing.T) {
+	chain := testRequirementChain(t, "Apple Development: Test (TEAMID1234)")
+	cdHash := []byte("0123456789abcdef0123")
+	ctx := &RequirementContext{
+		Certificates: chain,
+		AppleAnchors: chain[2:],
+		Identifier:   "com.example.app",
+		InfoFile: map[string]interface{}{
+			"CFBundleIdentifier": "com.example.app",
+			"CFBundleVersion":    "1.10",
+			"LSRequiresIPhoneOS": true,
+			"UIDeviceFamily":     []interface{}{uint64(1), uint64(2)},
+		},
+		Entitlements: EntitlementsFile{
+			"application-identifier": "TEAMID1234.com.example.app",
+			"get-task-allow":         true,
+			"keychain-access-groups": []interface{}{"TEAMID1234.shared", "TEAMID1234.com.example.app"},
+		},
+		CDHashes: [][]byte{make([]byte, 20), cdHash},
+	}
+	sha1Hex := func(cert *x509.Certificate)string {
+		hash := sha1.Sum(cert.Raw)
+		return fmt.Sprintf("%x", hash)
+	}
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{`always`, true},
+		{`never`, false},
+		{`identifier "com.example.app"`, true},
+		{`identifier "com.example.other"`, false},
+		// anchor apple要求叶子证书是Apple自己的Software Signing证书
+		{`anchor apple generic`, true},
+		{`anchor apple`, false},
+		{`anchor = H"` + sha1Hex(chain[2]) + `"`, true},
+		{`certificate root = H"` + sha1Hex(chain[2]) + `"`, true},
+		{`certificate 1 = H"` + sha1Hex(chain[1]) + `"`, true},
+		{`certificate leaf = H"` + sha1Hex(chain[2]) + `"`, false},
+		{`certificate 3 = H"` + sha1Hex(chain[2]) + `"`, false},
+		{`certificate leaf[subject.CN] = "Apple Development: Test (TEAMID1234)"`, true},
+		{`certificate leaf[subject.OU] = TEAMID1234`, true},
+		{`certificate leaf[subject.OU] = OTHERTEAM`, false},
+		{`certificate leaf[subject.CN] = "Apple Development:"*`, true},
+		{`certificate leaf[subject.CN] = *"(TEAMID1234)"`, true},
+		{`certificate leaf[subject.CN] = *Test*`, true},
+		{`certificate leaf[subject.CN] ~ Distribution`, false},
+		{`certificate leaf[issuer.CN] = "Apple Worldwide Developer Relations Certification Authority"`, true},
+		{`certificate 1[subject.O] = "Apple Inc."`, true},
+		{`certificate root[subject.O] = "Apple Inc."`, true},
+		{`certificate -2[subject.CN] = "Apple Worldwide Developer Relations Certification Authority"`, true},
+		{`certificate leaf[subject.O] exists`, false},
+		{`certificate leaf[field.1.2.840.113635.100.6.1.2] exists`, true},
+		{`certificate leaf[field.1.2.840.113635.100.6.1.4] exists`, false},
+		{`certificate leaf[field.1.2.840.113635.100.6.1.4] absent`, true},
+		{`certificate leaf[field.1.2.840.113635.100.6.1.2] absent`, false},
+		{`certificate 1[field.1.2.840.113635.100.6.1.2] exists`, false},
+		{`certificate leaf[policy.1.2.840.113635.100.5.1] exists`, true},
+		{`certificate leaf[policy.1.2.840.113635.100.5.2] exists`, false},
+		{`certificate leaf[policy.1.2.840.113635.100.5.2] absent`, true},
+		{`certificate root[policy.1.2.840.113635.100.5.1] exists`, false},
+		{`info[CFBundleIdentifier] = "com.example.app"`, true},
+		{`info[CFBundleIdentifier] = com.example.*`, true},
+		{`info[CFBundleIdentifier] = *.other`, false},
+		{`info[CFBundleIdentifier] ~ example`, true},
+		{`info[CFBundleVersion] >= "1.9"`, true},
+		{`info[CFBundleVersion] > "1.10"`, false},
+		{`info[CFBundleVersion] <= "1.10"`, true},
+		{`info[CFBundleVersion] < "1.9"`, false},
+		{`info[CFBundleVersion] < "2"`, true},
+		{`info[LSRequiresIPhoneOS] = "true"`, true},
+		{`info[UIDeviceFamily] = 2`, true},
+		{`info[UIDeviceFamily] = 3`, false},
+		{`info[LSUIElement] exists`, false},
+		{`info[LSUIElement] absent`, true},
+		{`info[CFBundleVersion] absent`, false},
+		{`entitlement["get-task-allow"] exists`, true},
+		{`entitlement["application-identifier"] = TEAMID1234.*`, true},
+		{`entitlement["keychain-access-groups"] = "TEAMID1234.shared"`, true},
+		{`entitlement["keychain-access-groups"] = "OTHERTEAM.shared"`, false},
+		{`entitlement["com.apple.developer.team-identifier"] exists`, false},
+		{`cdhash H"` + fmt.Sprintf("%x", cdHash) + `"`, true},
+		{`cdhash H"` + strings.Repeat("ff", 20) + `"`, false},
+		{`! anchor apple`, true},
+		{`anchor apple or identifier "com.example.app"`, true},
+		{`anchor apple generic and ! identifier "com.example.app"`, false},
+		{`! (identifier "com.example.other" or anchor apple) and anchor apple generic`, true},
+	}
+	for _, test := range tests {
+		requirement, err := CompileRequirement(test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+			continue
+		}
+		ok, err := requirement.Evaluate(ctx)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+		} else if ok != test.want {
+			t.Errorf("%s: evaluated to %v, expected %v", test.text, ok, test.want)
+		}
+	}
+
+	// 根证书不是Apple的根证书
+	ctx.AppleAnchors = nil
+	for _, text := range []string{`anchor apple generic`, `anchor apple`} {
+		requirement, _ := CompileRequirement(text)
+		if ok, err := requirement.Evaluate(ctx); ok || err != nil {
+			t.Errorf("%s: evaluated to %v, %v without an Apple anchor", text, ok, err)
+		}
+	}
+}
+
+func TestEvaluateAppleAnchor(t *testing.T) {
+	chain := testRequirementChain(t, appleSoftwareSigningCN)
+	ctx := &RequirementContext{Certificates: chain, AppleAnchors: chain[2:]}
+	requirement, err := CompileRequirement(`anchor apple`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := requirement.Evaluate(ctx); !ok || err != nil {
+		t.Errorf("anchor apple evaluated to %v, %v for a Software Signing leaf", ok, err)
+	}
+}
+
+func TestEvaluateRequirementErrors(t *testing.T) {
+	ctx := &RequirementContext{Certificates: testRequirementChain(t, "Apple Development: Test (TEAMID1234)")}
+	for _, text := range []string{
+		`anchor trusted`,
+		`certificate leaf[policy.1.2.840.113635.100.5.1] = "1.2.840.113635.100.5.1"`,
+		`identifier "com.example.app" or certificate leaf[policy.1.2.840.113635.100.5.1] ~ apple`,
+	} {
+		requirement, err := CompileRequirement(text)
+		if err != nil {
+			t.Errorf("%s: %v", text, err)
+			continue
+		}
+		if ok, err := requirement.Evaluate(ctx); ok || err == nil {
+			t.Errorf("%s: expected an error, got %v, %v", text, ok, err)
+		}
+	}
+}
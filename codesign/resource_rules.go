@@ -0,0 +1,198 @@
+package codesign
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"regexp"
+	"strings"
+
+	"howett.net/plist"
+)
+
+// CodeResources中rules/rules2的一条规则
+type ResourceRule struct {
+	Pattern  string
+	Omit     bool    // 不记录匹配的文件
+	Optional bool    // 文件可以不存在
+	Nested   bool    // 匹配的文件是嵌套代码，只能通过AddNestedCode记录
+	Weight   float64 // 多条规则匹配时取权重最大的，0表示默认权重1
+	regexp   *regexp.Regexp
+}
+
+func NewResourceRule(pattern string, omit, optional, nested bool, weight float64)*ResourceRule {
+	return &ResourceRule{
+		Pattern:  pattern,
+		Omit:     omit,
+		Optional: optional,
+		Nested:   nested,
+		Weight:   weight,
+		regexp:   regexp.MustCompile(pattern),
+	}
+}
+
+func(r *ResourceRule)weight()float64 {
+	if r.Weight == 0 {
+		return 1
+	}
+	return r.Weight
+}
+
+func(r *ResourceRule)plistValue()interface{} {
+	if !r.Omit && !r.Optional && !r.Nested && r.Weight == 0 {
+		return true
+	}
+	value := make(map[string]interface{})
+	if r.Omit {
+		value["omit"] = true
+	}
+	if r.Optional {
+		value["optional"] = true
+	}
+	if r.Nested {
+		value["nested"] = true
+	}
+	if r.Weight != 0 {
+		value["weight"] = r.Weight
+	}
+	return value
+}
+
+// 苹果iOS默认的rules
+func DefaultResourceRules()[]*ResourceRule {
+	return []*ResourceRule{
+		NewResourceRule(`^.*`, false, false, false, 0),
+		NewResourceRule(`^.*\.lproj/`, false, true, false, 1000),
+		NewResourceRule(`^.*\.lproj/locversion.plist$`, true, false, false, 1100),
+		NewResourceRule(`^Base\.lproj/`, false, false, false, 1010),
+		NewResourceRule(`^version.plist$`, false, false, false, 0),
+	}
+}
+
+// 苹果iOS默认的rules2
+func DefaultResourceRules2()[]*ResourceRule {
+	return []*ResourceRule{
+		NewResourceRule(`.*\.dSYM($|/)`, false, false, false, 11),
+		NewResourceRule(`^(.*/)?\.DS_Store$`, true, false, false, 2000),
+		NewResourceRule(`^.*`, false, false, false, 0),
+		NewResourceRule(`^.*\.lproj/`, false, true, false, 1000),
+		NewResourceRule(`^.*\.lproj/locversion.plist$`, true, false, false, 1100),
+		NewResourceRule(`^Base\.lproj/`, false, false, false, 1010),
+		NewResourceRule(`^Info\.plist$`, true, false, false, 20),
+		NewResourceRule(`^PkgInfo$`, true, false, false, 20),
+		NewResourceRule(`^embedded\.provisionprofile$`, false, false, false, 20),
+		NewResourceRule(`^version\.plist$`, false, false, false, 20),
+	}
+}
+
+// 返回匹配name的权重最大的规则
+func MatchResourceRule(rules []*ResourceRule, name string)*ResourceRule {
+	var match *ResourceRule
+	for _, rule := range rules {
+		if rule.regexp == nil {
+			rule.regexp = regexp.MustCompile(rule.Pattern)
+		}
+		if rule.regexp.MatchString(name) && (match == nil || rule.weight() > match.weight()) {
+			match = rule
+		}
+	}
+	return match
+}
+
+const CodeSignatureDirectory = "_CodeSignature/"
+
+// 根据bundle中的文件生成新的CodeResources
+type CodeResourcesBuilder struct {
+	Rules  []*ResourceRule
+	Rules2 []*ResourceRule
+	files  map[string]interface{}
+	files2 map[string]interface{}
+}
+
+func NewCodeResourcesBuilder()*CodeResourcesBuilder {
+	return &CodeResourcesBuilder{
+		Rules:  DefaultResourceRules(),
+		Rules2: DefaultResourceRules2(),
+		files:  make(map[string]interface{}),
+		files2: make(map[string]interface{}),
+	}
+}
+
+// 添加bundle中的普通文件，name为相对于bundle的路径
+func(b *CodeResourcesBuilder)AddFile(name string, data []byte) {
+	if strings.HasPrefix(name, CodeSignatureDirectory) {
+		return
+	}
+	b.AddLegacyFile(name, data)
+	rule := MatchResourceRule(b.Rules2, name)
+	if rule == nil || rule.Omit || rule.Nested {
+		return
+	}
+	sha1Hash := sha1.Sum(data)
+	sha256Hash := sha256.Sum256(data)
+	node := map[string]interface{}{
+		"hash":  sha1Hash[:],
+		"hash2": sha256Hash[:],
+	}
+	if rule.Optional {
+		node["optional"] = true
+	}
+	b.files2[name] = node
+}
+
+// 只记录到files中，用于嵌套代码内的文件
+func(b *CodeResourcesBuilder)AddLegacyFile(name string, data []byte) {
+	if strings.HasPrefix(name, CodeSignatureDirectory) {
+		return
+	}
+	rule := MatchResourceRule(b.Rules, name)
+	if rule == nil || rule.Omit {
+		return
+	}
+	sha1Hash := sha1.Sum(data)
+	if rule.Optional {
+		b.files[name] = map[string]interface{}{
+			"hash":     sha1Hash[:],
+			"optional": true,
+		}
+	} else {
+		b.files[name] = sha1Hash[:]
+	}
+}
+
+func(b *CodeResourcesBuilder)AddSymlink(name, target string) {
+	rule := MatchResourceRule(b.Rules2, name)
+	if rule == nil || rule.Omit {
+		return
+	}
+	b.files2[name] = map[string]interface{}{
+		"symlink": target,
+	}
+}
+
+// 嵌套的bundle或动态库，记录cdhash和指定要求
+func(b *CodeResourcesBuilder)AddNestedCode(name string, cdHash []byte, requirement string) {
+	b.files2[name] = map[string]interface{}{
+		"cdhash":      cdHash,
+		"requirement": requirement,
+	}
+}
+
+func(b *CodeResourcesBuilder)Build()*CodeResourcesFile {
+	rules := make(map[string]interface{})
+	for _, rule := range b.Rules {
+		rules[rule.Pattern] = rule.plistValue()
+	}
+	rules2 := make(map[string]interface{})
+	for _, rule := range b.Rules2 {
+		rules2[rule.Pattern] = rule.plistValue()
+	}
+	return &CodeResourcesFile{
+		dict: map[string]interface{}{
+			"files":  b.files,
+			"files2": b.files2,
+			"rules":  rules,
+			"rules2": rules2,
+		},
+		format: plist.XMLFormat,
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"io/ioutil"
+	"regexp"
 
 	"howett.net/plist"
 )
@@ -51,23 +52,77 @@ func(c *CodeResourcesFile)GetFileHash(fileName string)[]byte {
 }
 
 func(c *CodeResourcesFile)UpdateFileHash(fileName string, fileBytes []byte) {
-	filesNode := (c.dict[ "files"]).(map[string]interface{})
 	sha1Hash := sha1.Sum(fileBytes)
-	if _, ok := filesNode[fileName]; ok {
-		filesNode[fileName] = sha1Hash
+	if filesNode, ok := c.dict["files"].(map[string]interface{}); ok {
+		if _, ok := filesNode[fileName]; ok {
+			filesNode[fileName] = sha1Hash[:]
+		}
 	}
 
-	files2Node := (c.dict[ "files2"]).(map[string]interface{})
-	if files2Node == nil {
+	files2Node, ok := c.dict["files2"].(map[string]interface{})
+	if !ok {
 		return
 	}
 	if node, ok := files2Node[fileName]; ok {
 		switch node := node.(type) {
 		case map[string]interface{}:
 			sha256Hash := sha256.Sum256(fileBytes)
-			node["hash"] = sha1Hash
-			node["hash2"] = sha256Hash
+			node["hash"] = sha1Hash[:]
+			node["hash2"] = sha256Hash[:]
 		default:
 		}
 	}
-}
\ No newline at end of file
+}
+
+// 嵌套的bundle或动态库在files2中记录cdhash和指定要求
+func(c *CodeResourcesFile)UpdateNestedCode(name string, cdHash []byte, requirement string) {
+	files2Node, ok := c.dict["files2"].(map[string]interface{})
+	if !ok {
+		files2Node = make(map[string]interface{})
+		c.dict["files2"] = files2Node
+	}
+	files2Node[name] = map[string]interface{}{
+		"cdhash":      cdHash,
+		"requirement": requirement,
+	}
+}
+
+func(c *CodeResourcesFile)Files()map[string]interface{} {
+	files, _ := c.dict["files"].(map[string]interface{})
+	return files
+}
+
+func(c *CodeResourcesFile)Files2()map[string]interface{} {
+	files2, _ := c.dict["files2"].(map[string]interface{})
+	return files2
+}
+
+// rules2中的规则，无法解析的规则被忽略
+func(c *CodeResourcesFile)Rules2()[]*ResourceRule {
+	dict, _ := c.dict["rules2"].(map[string]interface{})
+	var rules []*ResourceRule
+	for pattern, value := range dict {
+		exp, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		rule := &ResourceRule{Pattern: pattern, regexp: exp}
+		if options, ok := value.(map[string]interface{}); ok {
+			rule.Omit, _ = options["omit"].(bool)
+			rule.Optional, _ = options["optional"].(bool)
+			rule.Nested, _ = options["nested"].(bool)
+			switch weight := options["weight"].(type) {
+			case float64:
+				rule.Weight = weight
+			case uint64:
+				rule.Weight = float64(weight)
+			case int64:
+				rule.Weight = float64(weight)
+			}
+		} else if enabled, ok := value.(bool); !ok || !enabled {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
@@ -23,6 +23,9 @@ const(
 	CS_Enforcement = 0x00001000              // CS_ENFORCEMENT
 	CS_RequireLibraryValidation = 0x00002000 // CS_REQUIRE_LV
 	CS_EntitlementsValidated = 0x00004000    // CS_ENTITLEMENTS_VALIDATED
+	CS_Host = 0x00000001                     // kSecCodeSignatureHost，CodeDirectory中与CS_VALID的值相同
+	CS_Runtime = 0x00010000                  // CS_RUNTIME
+	CS_LinkerSigned = 0x00020000             // CS_LINKER_SIGNED
 )
 
 type CodeSignatureBlob interface {
@@ -66,25 +69,48 @@ func ComputeHashes(hashType byte , pageSize int , data []byte)[][]byte {
 	return hashes
 }
 
-const SpecialHashCount = 5
+const SpecialHashCount = 7
 const ApplicationSpecificHashOffset = 4
 const EntitlementsHashOffset = 5
+const DerEntitlementsHashOffset = 7
 func UpdateSpecialHashes(codeDirectory *CodeDirectory,
 	codeToHash, infoFileBytes []byte ,
 	codeRequirements *Requirements,
 	codeResBytes []byte,
-	entitlements *Entitlements) {
+	entitlements *Entitlements,
+	derEntitlements *DerEntitlements) {
 
 	ht := codeDirectory.HashType
 	codeDirectory.CodeHashes = ComputeHashes(ht, codeDirectory.GetPageSize(), codeToHash)
+	// 不存在的文件(如独立的动态库没有Info.plist)对应的hash为0
+	emptyHash := make([]byte, GetHashLength(ht))
+	hashOrEmpty := func(data []byte) []byte {
+		if len(data) == 0 {
+			return emptyHash
+		}
+		return ComputeHash(ht, data)
+	}
 	hashes := make([][]byte, 0, SpecialHashCount)
-	hashes = append(hashes, ComputeHash(ht, infoFileBytes))
+	hashes = append(hashes, hashOrEmpty(infoFileBytes))
 	hashes = append(hashes, ComputeHash(ht, codeRequirements.GetBytes()))
-	hashes = append(hashes, ComputeHash(ht, codeResBytes))
+	hashes = append(hashes, hashOrEmpty(codeResBytes))
 	if SpecialHashCount >= ApplicationSpecificHashOffset {
-		hashes = append(hashes, make([]byte, GetHashLength(ht)))
+		hashes = append(hashes, emptyHash)
 		if SpecialHashCount >= EntitlementsHashOffset {
-			hashes = append(hashes, ComputeHash(ht, entitlements.GetBytes()))
+			if entitlements != nil {
+				hashes = append(hashes, ComputeHash(ht, entitlements.GetBytes()))
+			} else {
+				hashes = append(hashes, emptyHash)
+			}
+			if SpecialHashCount >= DerEntitlementsHashOffset {
+				// CSSLOT_REP_SPECIFIC
+				hashes = append(hashes, emptyHash)
+				if derEntitlements != nil {
+					hashes = append(hashes, ComputeHash(ht, derEntitlements.GetBytes()))
+				} else {
+					hashes = append(hashes, emptyHash)
+				}
+			}
 		}
 	}
 	size := len(hashes)
@@ -94,53 +120,165 @@ func UpdateSpecialHashes(codeDirectory *CodeDirectory,
 	codeDirectory.SpecialHashes = hashes
 }
 
-func ResignExecutable(file *mach.MachObjectFile, bundleId string, certChain []*x509.Certificate,
-	privateKey crypto.Signer, infoFileBytes, codeResBytes []byte, entitlements map[string]interface{} ) error {
+// 权限对应的ExecSegFlags，同codesign，只用于主程序
+var execSegmentEntitlements = []struct {
+	key  string
+	flag uint64
+}{
+	{"get-task-allow", CS_ExecSegAllowUnsigned},
+	{"run-unsigned-code", CS_ExecSegAllowUnsigned},
+	{"com.apple.private.cs.debugger", CS_ExecSegDebugger},
+	{"dynamic-codesigning", CS_ExecSegJit},
+	{"com.apple.private.skip-library-validation", CS_ExecSegSkipLV},
+	{"com.apple.private.amfi.can-load-cdhash", CS_ExecSegCanLoadCDHash},
+	{"com.apple.private.amfi.can-execute-cdhash", CS_ExecSegCanExecCDHash},
+}
 
-	signCert := certChain[len(certChain)-1]
-	certificateCN := GetCertificateValue(signCert, X509CertificateCommonNameOID)
-	teamID := GetCertificateValue(signCert, X509CertificateOrganizationalUnitOID)
+// 可执行段的标志：主程序(MH_EXECUTE)设置CS_EXECSEG_MAIN_BINARY，get-task-allow等权限为true时设置对应的标志
+func ExecSegmentFlags(file *mach.MachObjectFile, entitlements EntitlementsFile)uint64 {
+	if file.Header.FileType != mach.FileTypeExecutable {
+		return 0
+	}
+	flags := uint64(CS_ExecSegMainBinary)
+	for _, item := range execSegmentEntitlements {
+		if value, ok := entitlements[item.key].(bool); ok && value {
+			flags |= item.flag
+		}
+	}
+	return flags
+}
 
-	linkEditSegment := mach.FindLinkEditSegment(file.LoadCommands)
-	if linkEditSegment == nil {
-		return errors.New("LinkEdit segment was not found")
+// 对单个Mach-O签名，返回cdhash(多个CodeDirectory时取hash最长的)
+// infoFileBytes、codeResBytes、entitlements为空时对应的特殊槽位hash为0
+// options.AdHoc时certChain和privateKey可以为nil
+func ResignExecutable(file *mach.MachObjectFile, bundleId string, certChain []*x509.Certificate,
+	privateKey crypto.Signer, infoFileBytes, codeResBytes []byte, entitlements map[string]interface{}, options *SignOptions) ([]byte, error) {
+
+	hashTypes, err := options.hashTypes()
+	if err != nil {
+		return nil, err
 	}
-	cmd := file.LoadCommands[len(file.LoadCommands)-1]
-	if cmd.Type() != mach.LC_CodeSignature {
-		return errors.New("the last LoadCommand entry is not CodeSignature")
+	adHoc := options.adHoc()
+	var certificateCN, teamID string
+	if !adHoc {
+		if len(certChain) == 0 || privateKey == nil {
+			return nil, errors.New("missing signing certificate or private key")
+		}
+		signCert := certChain[len(certChain)-1]
+		certificateCN = GetCertificateValue(signCert, X509CertificateCommonNameOID)
+		teamID = GetCertificateValue(signCert, X509CertificateOrganizationalUnitOID)
 	}
-	command := cmd.(*mach.CodeSignatureCommand)
 
+	// 在PrepareCodeSignature之前读取原签名的标志
+	flags, err := options.codeSignFlags(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// 没有签名的文件添加LC_CODE_SIGNATURE
+	command, err := file.PrepareCodeSignature()
+	if err != nil {
+		return nil, err
+	}
 	codeLength := command.DataOffset
 
-	codeDirectory := CreateCodeDirectory(codeLength, bundleId, teamID, HashTypeSHA1)
+	execSegBase, execSegLimit := file.TextSegmentRange()
+	execSegFlags := ExecSegmentFlags(file, entitlements)
+	codeDirectories := make([]*CodeDirectory, len(hashTypes))
+	for i, hashType := range hashTypes {
+		codeDirectories[i] = CreateCodeDirectory(codeLength, bundleId, teamID, hashType)
+		codeDirectories[i].SetExecSegment(execSegBase, execSegLimit, execSegFlags)
+		codeDirectories[i].Flags = flags
+		if adHoc {
+			codeDirectories[i].Flags |= CS_AdHoc
+		}
+		if flags&CS_Runtime != 0 {
+			codeDirectories[i].SetRuntime(file.SDKVersion())
+		}
+	}
 
-	codeRequirements := CreateRequirements(bundleId, certificateCN)
-	entitlementsBlob := CreateEntitlements(entitlements)
-	codeBytes1 := codeDirectory.GetBytes()
+	// ad-hoc签名默认是空的要求集合
+	codeRequirements := new(Requirements)
+	if !adHoc || options.DesignatedRequirement != "" {
+		designatedRequirement, err := DesignatedRequirement(bundleId, certificateCN, options)
+		if err != nil {
+			return nil, err
+		}
+		codeRequirements.Add(DesignatedRequirementType, designatedRequirement)
+	}
+	var entitlementsBlob *Entitlements
+	var derEntitlementsBlob *DerEntitlements
+	if entitlements != nil {
+		entitlementsBlob = CreateEntitlements(entitlements)
+		if derEntitlementsBlob, err = CreateDerEntitlements(entitlements); err != nil {
+			return nil, err
+		}
+	}
+	timestampURL := options.timestampURL()
+	signature := func(final bool)([]byte, error) {
+		if adHoc {
+			return nil, nil
+		}
+		attrs, err := CreateHashAgilityAttributes(codeDirectories)
+		if err != nil {
+			return nil, err
+		}
+		der, err := CmsGenerateSignature(certChain, privateKey, codeDirectories[0].GetBytes(), attrs)
+		if err != nil {
+			return nil, err
+		}
+		// 只对最终的签名请求时间戳，计算长度时使用预留的空间
+		if final && timestampURL != "" {
+			return AddCmsTimestamp(der, timestampURL, options.timestampTimeout())
+		}
+		return der, nil
+	}
 	cmsSignature := new(CmsSignatureBlob)
-	cmsSignature.Data = CmsGenerateSignature(certChain, privateKey, codeBytes1)
+	if cmsSignature.Data, err = signature(false); err != nil {
+		return nil, err
+	}
 
 	codeSignature := new(CodeSignatureSuperBlob)
-	codeSignature.Add(CSSLOT_CODEDIRECTORY, codeDirectory)
+	codeSignature.Add(CSSLOT_CODEDIRECTORY, codeDirectories[0])
 	codeSignature.Add(CSSLOT_REQUIREMENTS, codeRequirements)
-	codeSignature.Add(CSSLOT_ENTITLEMENTS, entitlementsBlob)
+	if entitlementsBlob != nil {
+		codeSignature.Add(CSSLOT_ENTITLEMENTS, entitlementsBlob)
+	}
+	if derEntitlementsBlob != nil {
+		codeSignature.Add(CSSLOT_DER_ENTITLEMENTS, derEntitlementsBlob)
+	}
+	for i, codeDirectory := range codeDirectories[1:] {
+		codeSignature.Add(CSSLOT_ALTERNATE_CODEDIRECTORIES+uint32(i), codeDirectory)
+	}
 	codeSignature.Add(CSSLOT_SIGNATURESLOT, cmsSignature)
-	command.DataSize = uint32(codeSignature.Length())
-
-	finalFileSize := command.DataOffset + command.DataSize
-	mach.SegmentSetEndOffset(linkEditSegment, finalFileSize)
+	reserveSize := codeSignature.Length()
+	if !adHoc {
+		reserveSize += cmsSignatureSlack(privateKey)
+	}
+	if timestampURL != "" {
+		reserveSize += TimestampReserveSize
+	}
+	if err = file.ReserveCodeSignature(reserveSize); err != nil {
+		return nil, err
+	}
 
 	codeToHash := file.GetBytes()[0:codeLength]
-	UpdateSpecialHashes(codeDirectory, codeToHash, infoFileBytes, codeRequirements, codeResBytes, entitlementsBlob)
-
-	codeBytes2 := codeDirectory.GetBytes()
-	cmsSignature.Data = CmsGenerateSignature(certChain, privateKey, codeBytes2)
-	codeSignatureBytes := codeSignature.GetBytes()
-
-	newSize := int(codeLength) - file.DataOffset + int(command.DataSize)
-	file.Data = file.Data[:newSize]
-	offset := int(command.DataOffset) - file.DataOffset
-	copy(file.Data[offset:], codeSignatureBytes)
-	return nil
-}
\ No newline at end of file
+	for _, codeDirectory := range codeDirectories {
+		UpdateSpecialHashes(codeDirectory, codeToHash, infoFileBytes, codeRequirements, codeResBytes, entitlementsBlob, derEntitlementsBlob)
+	}
+
+	if cmsSignature.Data, err = signature(true); err != nil {
+		return nil, err
+	}
+	if err = file.WriteCodeSignature(codeSignature.GetBytes()); err != nil {
+		return nil, err
+	}
+
+	best := codeDirectories[0]
+	for _, codeDirectory := range codeDirectories[1:] {
+		if codeDirectory.HashSize > best.HashSize {
+			best = codeDirectory
+		}
+	}
+	return best.CDHash(), nil
+}
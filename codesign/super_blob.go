@@ -1,17 +1,25 @@
 package codesign
 
-import "encoding/binary"
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/gamebtc/appsign/mach"
+)
 
 const(
 	CSSLOT_REQUIREMENTS              = 0x00000002 // The signature of this entry type will be CSMAGIC_REQUIREMENTS
 	CSSLOT_ENTITLEMENTS              = 0x00000005 // The signature of this entry type will be CSMAGIC_EMBEDDED_ENTITLEMENTS
+	CSSLOT_DER_ENTITLEMENTS          = 0x00000007 // The signature of this entry type will be CSMAGIC_EMBEDDED_DER_ENTITLEMENTS
 	CSSLOT_ALTERNATE_CODEDIRECTORIES = 0x00001000 // The signature of this entry type will be CSMAGIC_CODEDIRECTORY
+	CSSLOT_ALTERNATE_CODEDIRECTORY_MAX = 5        // max number of alternate CodeDirectory slots
 	CSSLOT_SIGNATURESLOT             = 0x00010000 // The signature of this entry type will be CSMAGIC_BLOBWRAPPER
 )
 
 // https://opensource.apple.com/source/Security/Security-55471/sec/Security/Tool/codesign.c
 
-const CodeSignatureSuperBlobSign = 0xfade0cc0
 const CodeSignatureSuperBlobSize = 12
 type CodeSignatureSuperBlob struct {
 	// uint Magic;
@@ -21,28 +29,124 @@ type CodeSignatureSuperBlob struct {
 	Values []CodeSignatureBlob
 }
 
-func(c *CodeSignatureSuperBlob )Load(buffer []byte)int {
-	// length := int(binary.BigEndian.Uint32(buffer[4:]))
-	count := int(binary.BigEndian.Uint32(buffer[8:]))
-	length := RequirementsSize + count*8
-	for i := 0; i < count; i++ {
-		offset := RequirementsSize + i*8
+// 读取一个blob，根据magic解析为对应的类型
+// 无法识别或者不能原样写回的blob保留为CodeSignatureGenericBlob，保证重新序列化后字节一致
+func ReadCodeSignatureBlob(buffer []byte)(CodeSignatureBlob, error) {
+	raw, err := readBlob(buffer, 0)
+	if err != nil {
+		return nil, err
+	}
+	var blob codeSignatureBlobLoader
+	switch binary.BigEndian.Uint32(raw) {
+	case CSMAGIC_CODEDIRECTORY:
+		if _, err := loadCodeDirectory(raw); err == nil {
+			blob = new(CodeDirectory)
+		}
+	case CSMAGIC_REQUIREMENTS:
+		blob = new(Requirements)
+	case CSMAGIC_REQUIREMENT:
+		blob = new(Requirement)
+	case CSMAGIC_EMBEDDED_ENTITLEMENTS:
+		blob = NewEntitlements()
+	case CSMAGIC_EMBEDDED_DER_ENTITLEMENTS:
+		blob = NewDerEntitlements()
+	case CmsSignatureBlobSign:
+		blob = new(CmsSignatureBlob)
+	}
+	if blob == nil || !loadBlob(blob, raw) {
+		generic := new(CodeSignatureGenericBlob)
+		generic.Load(raw)
+		return generic, nil
+	}
+	return blob, nil
+}
+
+type codeSignatureBlobLoader interface {
+	CodeSignatureBlob
+	Load(buffer []byte)int
+}
+
+// 要求表达式的Load没有边界检查，先检查结构，解析后要求能原样写回
+func loadBlob(blob codeSignatureBlobLoader, raw []byte)bool {
+	switch blob.(type) {
+	case *Requirements:
+		if checkRequirements(raw) != nil {
+			return false
+		}
+	case *Requirement:
+		if checkRequirement(raw) != nil {
+			return false
+		}
+	}
+	if blob.Load(raw) != len(raw) || blob.Length() != len(raw) {
+		return false
+	}
+	buffer := make([]byte, len(raw))
+	blob.WriteBytes(buffer)
+	return bytes.Equal(buffer, raw)
+}
+
+// 解析签名数据，buffer可以包含签名之后的填充数据
+func ReadCodeSignatureSuperBlob(buffer []byte)(*CodeSignatureSuperBlob, error) {
+	if len(buffer) < CodeSignatureSuperBlobSize {
+		return nil, errors.New("code signature is truncated")
+	}
+	if binary.BigEndian.Uint32(buffer) != CSMAGIC_EMBEDDED_SIGNATURE {
+		return nil, errors.New("invalid code signature magic")
+	}
+	buffer, err := readBlob(buffer, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(buffer) < CodeSignatureSuperBlobSize {
+		return nil, errors.New("code signature is truncated")
+	}
+	count := binary.BigEndian.Uint32(buffer[8:])
+	if uint64(CodeSignatureSuperBlobSize)+uint64(count)*8 > uint64(len(buffer)) {
+		return nil, errors.New("code signature index is truncated")
+	}
+	c := new(CodeSignatureSuperBlob)
+	for i := uint32(0); i < count; i++ {
+		offset := CodeSignatureSuperBlobSize + i*8
 		entryType := binary.BigEndian.Uint32(buffer[offset:])
 		entryOffset := binary.BigEndian.Uint32(buffer[offset+4:])
-		blob, n := ReadRequirement(buffer[entryOffset:])
-		c.Keys = append(c.Keys, entryType)
-		c.Values = append(c.Values, blob)
-		length += n
+		if uint64(entryOffset) > uint64(len(buffer)) {
+			return nil, fmt.Errorf("slot 0x%x: blob offset out of range", entryType)
+		}
+		blob, err := ReadCodeSignatureBlob(buffer[entryOffset:])
+		if err != nil {
+			return nil, fmt.Errorf("slot 0x%x: %v", entryType, err)
+		}
+		c.Add(entryType, blob)
 	}
-	return length
+	return c, nil
+}
+
+// 解析Mach-O中嵌入的签名
+func ParseCodeSignature(file *mach.MachObjectFile)(*CodeSignatureSuperBlob, error) {
+	if file.GetLoadCommand(mach.LC_CodeSignature) == nil {
+		return nil, errors.New("code object is not signed at all")
+	}
+	return ReadCodeSignatureSuperBlob(file.GetCodeSignatureBytes())
+}
+
+// 重新序列化时blob按索引顺序连续排列
+func(c *CodeSignatureSuperBlob)Load(buffer []byte)int {
+	blob, err := ReadCodeSignatureSuperBlob(buffer)
+	if err != nil {
+		return 0
+	}
+	c.Keys = blob.Keys
+	c.Values = blob.Values
+	return c.Length()
 }
 
 func(c *CodeSignatureSuperBlob)WriteBytes(buffer []byte)int {
 	count := len(c.Keys)
-	binary.BigEndian.PutUint32(buffer, CodeSignatureSuperBlobSign)
-	binary.BigEndian.PutUint32(buffer[4:], CodeSignatureSuperBlobSize)
+	binary.BigEndian.PutUint32(buffer, CSMAGIC_EMBEDDED_SIGNATURE)
+	binary.BigEndian.PutUint32(buffer[4:], uint32(c.Length()))
 	binary.BigEndian.PutUint32(buffer[8:], uint32(count))
-	blobOffset := CodeSignatureSuperBlobSign + count*8
+	blobOffset := CodeSignatureSuperBlobSize + count*8
 	for i := 0; i < count; i++ {
 		binary.BigEndian.PutUint32(buffer[ 12+i*8:], c.Keys[i])
 		binary.BigEndian.PutUint32(buffer[ 12+i*8+4:], uint32(blobOffset))
@@ -60,7 +164,7 @@ func(c *CodeSignatureSuperBlob)GetBytes()[]byte {
 
 func(c *CodeSignatureSuperBlob)Length()int {
 	count := len(c.Keys)
-	length := RequirementsSize + count*8
+	length := CodeSignatureSuperBlobSize + count*8
 	for i := 0; i < count; i++ {
 		l := c.Values[i].Length()
 		length += l
@@ -72,3 +176,34 @@ func(c *CodeSignatureSuperBlob )Add(k uint32, v CodeSignatureBlob ) {
 	c.Keys = append(c.Keys, k)
 	c.Values = append(c.Values, v)
 }
+
+// 槽位对应的blob，不存在时返回nil
+func(c *CodeSignatureSuperBlob)Get(k uint32)CodeSignatureBlob {
+	for i, key := range c.Keys {
+		if key == k {
+			return c.Values[i]
+		}
+	}
+	return nil
+}
+
+// 替换槽位的blob，不存在时添加
+func(c *CodeSignatureSuperBlob)Set(k uint32, v CodeSignatureBlob) {
+	for i, key := range c.Keys {
+		if key == k {
+			c.Values[i] = v
+			return
+		}
+	}
+	c.Add(k, v)
+}
+
+func(c *CodeSignatureSuperBlob)Remove(k uint32) {
+	for i, key := range c.Keys {
+		if key == k {
+			c.Keys = append(c.Keys[:i], c.Keys[i+1:]...)
+			c.Values = append(c.Values[:i], c.Values[i+1:]...)
+			return
+		}
+	}
+}
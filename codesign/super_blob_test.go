@@ -0,0 +1,70 @@
+package codesign
+
+import (
+	"bytes"
+	"testing"
+)
+
+const testRequirements = `designated => identifier "com.example.app" and anchor apple generic and ` +
+	`certificate leaf[subject.CN] = "Apple Development: Test (TEAMID1234)" and ` +
+	`certificate 1[field.1.2.840.113635.100.6.2.1] exists and ` +
+	`(info[CFBundleVersion] >= "1.0" or entitlement["get-task-allow"] exists) and ! cdhash H"0123456789abcdef0123456789abcdef01234567" ` +
+	`library => anchor apple or anchor trusted`
+
+// 包含各种blob的签名：两个CodeDirectory、要求集合、权限和CMS
+func testCodeSignature(t testing.TB)*CodeSignatureSuperBlob {
+	requirements, err := CompileRequirements(testRequirements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entitlements := EntitlementsFile{"application-identifier": "TEAMID1234.com.example.app", "get-task-allow": true}
+	derEntitlements, err := CreateDerEntitlements(entitlements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codeSignature := new(CodeSignatureSuperBlob)
+	codeDirectory := CreateCodeDirectory(0x2000, "com.example.app", "TEAMID1234", HashTypeSHA1)
+	codeDirectory.SetExecSegment(0, 0x1000, CS_ExecSegMainBinary)
+	codeSignature.Add(CSSLOT_CODEDIRECTORY, codeDirectory)
+	codeSignature.Add(CSSLOT_REQUIREMENTS, requirements)
+	codeSignature.Add(CSSLOT_ENTITLEMENTS, CreateEntitlements(entitlements))
+	codeSignature.Add(CSSLOT_DER_ENTITLEMENTS, derEntitlements)
+	codeDirectory = CreateCodeDirectory(0x2000, "com.example.app", "TEAMID1234", HashTypeSHA256)
+	codeDirectory.SetRuntime(0xe0000)
+	codeSignature.Add(CSSLOT_ALTERNATE_CODEDIRECTORIES, codeDirectory)
+	codeSignature.Add(CSSLOT_SIGNATURESLOT, &CmsSignatureBlob{Data: []byte{0x30, 0x80, 0x06, 0x09}})
+	return codeSignature
+}
+
+func FuzzReadCodeSignatureSuperBlob(f *testing.F) {
+	signature := testCodeSignature(f).GetBytes()
+	f.Add(signature)
+	f.Add(append(signature, make([]byte, 64)...))
+	adHoc := new(CodeSignatureSuperBlob)
+	adHoc.Add(CSSLOT_CODEDIRECTORY, CreateCodeDirectory(0x1000, "tool", "", HashTypeSHA256))
+	adHoc.Add(CSSLOT_REQUIREMENTS, new(Requirements))
+	adHoc.Add(CSSLOT_SIGNATURESLOT, new(CmsSignatureBlob))
+	f.Add(adHoc.GetBytes())
+	f.Add(signature[:CodeSignatureSuperBlobSize])
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		codeSignature, err := ReadCodeSignatureSuperBlob(data)
+		if err != nil {
+			return
+		}
+		for _, blob := range codeSignature.Values {
+			if requirements, ok := blob.(*Requirements); ok {
+				_ = requirements.String()
+			}
+		}
+		// 重新序列化的签名可以再次解析，并且结果不变
+		buffer := codeSignature.GetBytes()
+		again, err := ReadCodeSignatureSuperBlob(buffer)
+		if err != nil {
+			t.Fatalf("serialized signature cannot be read: %v", err)
+		}
+		if !bytes.Equal(again.GetBytes(), buffer) {
+			t.Fatalf("serialized signature is not stable")
+		}
+	})
+}
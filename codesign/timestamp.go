@@ -0,0 +1,179 @@
+package codesign
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mastahyeti/cms/oid"
+	"github.com/mastahyeti/cms/protocol"
+	"github.com/mastahyeti/cms/timestamp"
+)
+
+// Apple的RFC 3161时间戳服务
+const AppleTimestampURL = "http://timestamp.apple.com/ts01"
+
+// 为时间戳token(包含TSA的证书链)预留的签名空间
+const TimestampReserveSize = 8192
+
+// 默认的时间戳请求超时时间
+const DefaultTimestampTimeout = 30 * time.Second
+
+// 时间戳响应的最大长度
+const maxTimestampResponseSize = 1 << 20
+
+// 向url的时间戳服务(TSA)请求CMS签名值的时间戳，添加为id-aa-timeStampToken非签名属性
+// 证书过期后，时间戳可以证明签名是在证书有效期内生成的，timeout为0时使用DefaultTimestampTimeout
+func AddCmsTimestamp(der []byte, url string, timeout time.Duration)([]byte, error) {
+	ci, err := protocol.ParseContentInfo(der)
+	if err != nil {
+		return nil, err
+	}
+	sd, err := ci.SignedDataContent()
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimestampTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	// 先请求所有的时间戳，避免部分失败
+	attrs := make([]protocol.Attribute, len(sd.SignerInfos))
+	for i, si := range sd.SignerInfos {
+		if attrs[i], err = requestTimestamp(client, si, url); err != nil {
+			return nil, errors.New("timestamp: " + err.Error())
+		}
+	}
+	for i := range sd.SignerInfos {
+		sd.SignerInfos[i].UnsignedAttrs = append(sd.SignerInfos[i].UnsignedAttrs, attrs[i])
+	}
+	return marshalSignedData(sd)
+}
+
+func requestTimestamp(client *http.Client, si protocol.SignerInfo, url string)(protocol.Attribute, error) {
+	hash, err := si.Hash()
+	if err != nil {
+		return protocol.Attribute{}, err
+	}
+	imprint, err := timestamp.NewMessageImprint(hash, bytes.NewReader(si.Signature))
+	if err != nil {
+		return protocol.Attribute{}, err
+	}
+	req := timestamp.Request{
+		Version:        1,
+		CertReq:        true,
+		Nonce:          timestamp.GenerateNonce(),
+		MessageImprint: imprint,
+	}
+	resp, err := postTimestampRequest(client, req, url)
+	if err != nil {
+		return protocol.Attribute{}, err
+	}
+	info, err := resp.Info()
+	if err != nil {
+		return protocol.Attribute{}, err
+	}
+	if err = verifyTimestampToken(resp.TimeStampToken); err != nil {
+		return protocol.Attribute{}, err
+	}
+	if !req.Matches(info) {
+		return protocol.Attribute{}, errors.New("response does not match the request")
+	}
+	return protocol.NewAttribute(oid.AttributeTimeStampToken, resp.TimeStampToken)
+}
+
+// 同timestamp.Request.Do，使用带超时的client
+func postTimestampRequest(client *http.Client, req timestamp.Request, url string)(timestamp.Response, error) {
+	der, err := asn1.Marshal(req)
+	if err != nil {
+		return timestamp.Response{}, err
+	}
+	httpResp, err := client.Post(url, "application/timestamp-query", bytes.NewReader(der))
+	if err != nil {
+		return timestamp.Response{}, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return timestamp.Response{}, errors.New("server returned " + strconv.Itoa(httpResp.StatusCode))
+	}
+	if contentType := httpResp.Header.Get("Content-Type"); contentType != "application/timestamp-reply" {
+		return timestamp.Response{}, errors.New("bad content type: " + contentType)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(httpResp.Body, maxTimestampResponseSize))
+	if err != nil {
+		return timestamp.Response{}, err
+	}
+	return timestamp.ParseResponse(body)
+}
+
+// 校验时间戳token中TSA的签名，签名证书需要包含在token中并可用于时间戳
+func verifyTimestampToken(token protocol.ContentInfo)error {
+	sd, err := token.SignedDataContent()
+	if err != nil {
+		return err
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oid.ContentTypeTSTInfo) {
+		return errors.New("timestamp token does not contain a TSTInfo")
+	}
+	content, err := sd.EncapContentInfo.EContentValue()
+	if err != nil {
+		return err
+	}
+	if len(sd.SignerInfos) != 1 {
+		return errors.New("timestamp token must have exactly one signer")
+	}
+	si := sd.SignerInfos[0]
+	certs, err := sd.X509Certificates()
+	if err != nil {
+		return err
+	}
+	cert, err := si.FindCertificate(certs)
+	if err != nil {
+		return errors.New("timestamp signing certificate: " + err.Error())
+	}
+	timeStamping := false
+	for _, usage := range cert.ExtKeyUsage {
+		timeStamping = timeStamping || usage == x509.ExtKeyUsageTimeStamping
+	}
+	if !timeStamping {
+		return errors.New("timestamp signing certificate is not for time stamping")
+	}
+	if si.SignedAttrs == nil {
+		return errors.New("timestamp token signed attributes are missing")
+	}
+	contentType, err := si.GetContentTypeAttribute()
+	if err != nil {
+		return err
+	}
+	if !contentType.Equal(sd.EncapContentInfo.EContentType) {
+		return errors.New("timestamp token content type attribute does not match")
+	}
+	hash, err := si.Hash()
+	if err != nil {
+		return err
+	}
+	md := hash.New()
+	md.Write(content)
+	digest, err := si.GetMessageDigestAttribute()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(digest, md.Sum(nil)) {
+		return errors.New("timestamp token message digest does not match")
+	}
+	// 签名是对签名属性DER编码(SET OF按编码排序)的签名
+	signedMessage, err := si.SignedAttrs.MarshaledForSigning()
+	if err != nil {
+		return err
+	}
+	if err = cert.CheckSignature(si.X509SignatureAlgorithm(), signedMessage, si.Signature); err != nil {
+		return errors.New("timestamp token signature: " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package codesign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mastahyeti/cms/oid"
+	"github.com/mastahyeti/cms/protocol"
+	"github.com/mastahyeti/cms/timestamp"
+)
+
+// TSA签名的时间戳token，usage为TSA证书的扩展用途，tamper修改签名后的SignedData
+func testTimestampToken(t *testing.T, info *timestamp.Info, usage []x509.ExtKeyUsage, tamper func(sd *protocol.SignedData))protocol.ContentInfo {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Timestamp Authority"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  usage,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infoDER, err := asn1.Marshal(*info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eci, err := protocol.NewEncapsulatedContentInfo(oid.ContentTypeTSTInfo, infoDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := protocol.NewSignedData(eci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sd.AddSignerInfo([]*x509.Certificate{cert}, key); err != nil {
+		t.Fatal(err)
+	}
+	if tamper != nil {
+		tamper(sd)
+	}
+	token, err := sd.ContentInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// 本地的时间戳服务，reply可以修改TSTInfo和响应，返回false时不再写入响应
+// reply没有设置TimeStampToken时使用testTimestampToken签名
+func testTimestampServer(t *testing.T, reply func(w http.ResponseWriter, info *timestamp.Info, resp *timestamp.Response) bool)*httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var req timestamp.Request
+		if _, err := asn1.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		info := &timestamp.Info{
+			Version:        1,
+			Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+			MessageImprint: req.MessageImprint,
+			SerialNumber:   big.NewInt(1),
+			GenTime:        time.Now().UTC().Truncate(time.Second),
+			Nonce:          req.Nonce,
+		}
+		resp := new(timestamp.Response)
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		if reply != nil && !reply(w, info, resp) {
+			return
+		}
+		if resp.Status.Status == 0 && resp.TimeStampToken.ContentType == nil {
+			resp.TimeStampToken = testTimestampToken(t, info, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}, nil)
+		}
+		der, err := asn1.Marshal(*resp)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Write(der)
+	}))
+	return server
+}
+
+func testCmsSignature(t *testing.T)[]byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := CreateCodeDirectory(0x1000, "com.example.app", "TEAMID1234", HashTypeSHA256).GetBytes()
+	der, err := CmsGenerateSignature(testCertChain(t, key), key, message, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestAddCmsTimestamp(t *testing.T) {
+	server := testTimestampServer(t, nil)
+	defer server.Close()
+	der := testCmsSignature(t)
+	stamped, err := AddCmsTimestamp(der, server.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ci, err := protocol.ParseContentInfo(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, err := ci.SignedDataContent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ci, err = protocol.ParseContentInfo(stamped); err != nil {
+		t.Fatal(err)
+	}
+	sd, err := ci.SignedDataContent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sd.SignerInfos) != 1 || len(sd.Certificates) != len(original.Certificates) {
+		t.Fatalf("timestamp changed the signer infos or certificates")
+	}
+	si := sd.SignerInfos[0]
+	if !bytes.Equal(si.Signature, original.SignerInfos[0].Signature) {
+		t.Errorf("timestamp changed the signature value")
+	}
+
+	// 时间戳是非签名属性，消息摘要为签名值的SHA-256
+	if len(si.UnsignedAttrs) != 1 || !si.UnsignedAttrs[0].Type.Equal(oid.AttributeTimeStampToken) {
+		t.Fatalf("missing id-aa-timeStampToken unsigned attribute")
+	}
+	value, err := si.UnsignedAttrs.GetOnlyAttributeValueBytes(oid.AttributeTimeStampToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := protocol.ParseContentInfo(value.FullBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenData, err := token.SignedDataContent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := timestamp.ParseInfo(tokenData.EncapContentInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imprint, err := timestamp.NewMessageImprint(crypto.SHA256, bytes.NewReader(si.Signature))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !imprint.Equal(info.MessageImprint) {
+		t.Errorf("timestamp token is not over the signature value")
+	}
+}
+
+func TestAddCmsTimestampErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply func(w http.ResponseWriter, info *timestamp.Info, resp *timestamp.Response) bool
+	}{
+		{"http error", func(w http.ResponseWriter, info *timestamp.Info, resp *timestamp.Response) bool {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return false
+		}},
+		{"content type", func(w http.ResponseWriter, info *timestamp.Info, resp *timestamp.Response) bool {
+			w.Header().Set("Content-Type", "text/html")
+			return true
+		}},
+		{"rejection", func(w http.ResponseWriter, info *timestamp.Info, resp *timestamp.Response) bool {
+			resp.Status.Status = 2
+			resp.Status.StatusString = resp.Status.StatusString.Append("bad request")
+			return true
+		}},
+		{"imprint mismatch", func(w http.ResponseWriter, info *timestamp.Info, resp *timestamp.Response) bool {
+			info.MessageImprint.HashedMessage = make([]byte, len(info.MessageImprint.HashedMessage))
+			return true
+		}},
+		{"nonce mismatch", func(w http.ResponseWriter, info *timestamp.Info, resp *timestamp.Response) bool {
+			info.Nonce = new(big.Int).Add(info.Nonce, big.NewInt(1))
+			return true
+		}},
+		{"token signature", func(w http.ResponseWriter, info *timestamp.Info, resp *timestamp.Response) bool {
+			resp.TimeStampToken = testTimestampToken(t, info, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+				func(sd *protocol.SignedData) {
+					sd.SignerInfos[0].Signature[len(sd.SignerInfos[0].Signature)-1] ^= 1
+				})
+			return true
+		}},
+		{"token content", func(w http.ResponseWriter, info *timestamp.Info, resp *timestamp.Response) bool {
+			resp.TimeStampToken = testTimestampToken(t, info, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+				func(sd *protocol.SignedData) {
+					// TSTInfo改变后消息摘要不再匹配
+					content := sd.EncapContentInfo.EContent.Bytes
+					content[len(content)-1] ^= 1
+				})
+			return true
+		}},
+		{"token signer", func(w http.ResponseWriter, info *timestamp.Info, resp *timestamp.Response) bool {
+			resp.TimeStampToken = testTimestampToken(t, info, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+				func(sd *protocol.SignedData) {
+					sd.ClearCertificates()
+				})
+			return true
+		}},
+		{"token key usage", func(w http.ResponseWriter, info *timestamp.Info, resp *timestamp.Response) bool {
+			resp.TimeStampToken = testTimestampToken(t, info, []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}, nil)
+			return true
+		}},
+	}
+	der := testCmsSignature(t)
+	for _, test := range tests {
+		server := testTimestampServer(t, test.reply)
+		_, err := AddCmsTimestamp(der, server.URL, 0)
+		server.Close()
+		if err == nil || !strings.HasPrefix(err.Error(), "timestamp: ") {
+			t.Errorf("%s: expected a timestamp error, got %v", test.name, err)
+		}
+	}
+	if _, err := AddCmsTimestamp(der, "http://127.0.0.1:0/", 0); err == nil {
+		t.Errorf("unreachable server: expected an error")
+	}
+
+	// 时间戳服务没有响应时在超时后返回错误
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	start := time.Now()
+	_, err := AddCmsTimestamp(der, server.URL, 100*time.Millisecond)
+	close(done)
+	server.Close()
+	if err == nil || time.Since(start) > 10*time.Second {
+		t.Errorf("unresponsive server: expected a timeout, got %v after %v", err, time.Since(start))
+	}
+}
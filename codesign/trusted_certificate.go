@@ -22,6 +22,10 @@ func(v *TrustedCertificates)WriteBytes(buffer []byte)int{
 	return v.Length()
 }
 
+func(v *TrustedCertificates)String()string {
+	return "anchor trusted"
+}
+
 
 type TrustedCertificate struct {
 	CertificateIndex uint32
@@ -43,4 +47,8 @@ func(v *TrustedCertificate)WriteBytes(buffer []byte)int {
 	binary.BigEndian.PutUint32(buffer, ExprTrustedCertificate)
 	binary.BigEndian.PutUint32(buffer[4:], v.CertificateIndex)
 	return 8
-}
\ No newline at end of file
+}
+
+func(v *TrustedCertificate)String()string {
+	return "certificate " + certSlotString(v.CertificateIndex) + " trusted"
+}
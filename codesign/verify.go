@@ -0,0 +1,436 @@
+package codesign
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mastahyeti/cms/protocol"
+	"howett.net/plist"
+
+	"github.com/gamebtc/appsign/mach"
+)
+
+// 校验失败的一项
+type VerifyFailure struct {
+	Path    string // 出错的文件，为空表示校验对象自身
+	Message string
+}
+
+func(f *VerifyFailure)String()string {
+	if f.Path == "" {
+		return f.Message
+	}
+	return f.Path + ": " + f.Message
+}
+
+// 签名校验结果，Failures为空表示校验通过
+type VerifyReport struct {
+	Failures []*VerifyFailure
+}
+
+func(r *VerifyReport)OK()bool {
+	return len(r.Failures) == 0
+}
+
+func(r *VerifyReport)Fail(path, format string, args ...interface{}) {
+	r.Failures = append(r.Failures, &VerifyFailure{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// 合并other中的失败项，path作为路径前缀
+func(r *VerifyReport)Merge(path string, other *VerifyReport) {
+	for _, failure := range other.Failures {
+		failurePath := path
+		if failure.Path != "" {
+			failurePath = path + " " + failure.Path
+		}
+		r.Failures = append(r.Failures, &VerifyFailure{Path: failurePath, Message: failure.Message})
+	}
+}
+
+// 签名校验选项
+type VerifyOptions struct {
+	Roots         *x509.CertPool      // 信任的根证书，为nil时不校验证书链
+	Intermediates []*x509.Certificate // 中间证书，CMS中附带的证书会自动加入
+	// 为true时校验Info.plist和CodeResources槽位，数据为空时要求对应的hash为0
+	CheckResources     bool
+	InfoFileBytes      []byte
+	CodeResourcesBytes []byte
+}
+
+// Mach-O中嵌入的签名，Blobs为各槽位的原始数据
+type EmbeddedSignature struct {
+	SuperBlob          *CodeSignatureSuperBlob
+	Blobs              map[uint32][]byte
+	CodeDirectories    []*CodeDirectory // 第一个为CSSLOT_CODEDIRECTORY，其余为备用
+	codeDirectoryBlobs [][]byte
+}
+
+func readBlob(buffer []byte, offset uint32)([]byte, error) {
+	if uint64(offset)+8 > uint64(len(buffer)) {
+		return nil, errors.New("blob offset out of range")
+	}
+	length := binary.BigEndian.Uint32(buffer[offset+4:])
+	if length < 8 || uint64(offset)+uint64(length) > uint64(len(buffer)) {
+		return nil, errors.New("blob length out of range")
+	}
+	return buffer[offset : offset+length], nil
+}
+
+func loadCodeDirectory(blob []byte)(*CodeDirectory, error) {
+	if len(blob) < CDB_FixedLengthV20001 || !IsCodeDirectory(blob) {
+		return nil, errors.New("invalid code directory")
+	}
+	hashOffset := uint64(binary.BigEndian.Uint32(blob[16:]))
+	identOffset := uint64(binary.BigEndian.Uint32(blob[20:]))
+	specialSlots := uint64(binary.BigEndian.Uint32(blob[24:]))
+	codeSlots := uint64(binary.BigEndian.Uint32(blob[28:]))
+	hashSize := uint64(blob[36])
+	if hashSize == 0 || hashSize != uint64(GetHashLength(blob[37])) {
+		return nil, errors.New("unsupported code directory hash type")
+	}
+	if specialSlots*hashSize > hashOffset || hashOffset+codeSlots*hashSize > uint64(len(blob)) ||
+		identOffset >= uint64(len(blob)) || bytes.IndexByte(blob[identOffset:], 0) < 0 {
+		return nil, errors.New("code directory is truncated")
+	}
+	version := binary.BigEndian.Uint32(blob[8:])
+	if len(blob) < codeDirectoryFixedLength(version) {
+		return nil, errors.New("code directory is truncated")
+	}
+	if version >= CDB_TeamIDMinimumVersion {
+		teamIDOffset := uint64(binary.BigEndian.Uint32(blob[48:]))
+		if teamIDOffset >= uint64(len(blob)) || bytes.IndexByte(blob[teamIDOffset:], 0) < 0 {
+			return nil, errors.New("code directory is truncated")
+		}
+	}
+	codeDirectory := new(CodeDirectory)
+	codeDirectory.Load(blob)
+	return codeDirectory, nil
+}
+
+// 解析Mach-O中嵌入的签名
+func ParseEmbeddedSignature(file *mach.MachObjectFile)(*EmbeddedSignature, error) {
+	superBlob, err := ParseCodeSignature(file)
+	if err != nil {
+		return nil, err
+	}
+	s := &EmbeddedSignature{SuperBlob: superBlob, Blobs: make(map[uint32][]byte)}
+	for i, slot := range superBlob.Keys {
+		blob := superBlob.Values[i]
+		buffer := make([]byte, blob.Length())
+		blob.WriteBytes(buffer)
+		s.Blobs[slot] = buffer
+	}
+
+	slots := []uint32{CSSLOT_CODEDIRECTORY}
+	for i := uint32(0); i < CSSLOT_ALTERNATE_CODEDIRECTORY_MAX; i++ {
+		slots = append(slots, CSSLOT_ALTERNATE_CODEDIRECTORIES+i)
+	}
+	for _, slot := range slots {
+		blob, ok := s.Blobs[slot]
+		if !ok {
+			continue
+		}
+		codeDirectory, err := loadCodeDirectory(blob)
+		if err != nil {
+			return nil, fmt.Errorf("slot 0x%x: %v", slot, err)
+		}
+		s.CodeDirectories = append(s.CodeDirectories, codeDirectory)
+		s.codeDirectoryBlobs = append(s.codeDirectoryBlobs, blob)
+	}
+	if _, ok := s.Blobs[CSSLOT_CODEDIRECTORY]; !ok {
+		return nil, errors.New("code directory is missing")
+	}
+	return s, nil
+}
+
+// 签名的标识符(bundle id)
+func(s *EmbeddedSignature)Identifier()string {
+	return s.CodeDirectories[0].Ident
+}
+
+// 所有CodeDirectory的cdhash，顺序同CodeDirectories
+func(s *EmbeddedSignature)CDHashes()[][]byte {
+	hashes := make([][]byte, len(s.codeDirectoryBlobs))
+	for i, blob := range s.codeDirectoryBlobs {
+		hashes[i] = ComputeHash(s.CodeDirectories[i].HashType, blob)[:SHA1Length]
+	}
+	return hashes
+}
+
+func(s *EmbeddedSignature)IsAdHoc()bool {
+	return s.CodeDirectories[0].Flags&CS_AdHoc != 0
+}
+
+func VerifyExecutable(file *mach.MachObjectFile)*VerifyReport {
+	return VerifyExecutableWithOptions(file, nil)
+}
+
+// 校验Mach-O的签名：代码页hash、特殊槽位hash、CMS签名和证书链
+func VerifyExecutableWithOptions(file *mach.MachObjectFile, options *VerifyOptions)*VerifyReport {
+	if options == nil {
+		options = new(VerifyOptions)
+	}
+	report := new(VerifyReport)
+	signature, err := ParseEmbeddedSignature(file)
+	if err != nil {
+		report.Fail("", "%v", err)
+		return report
+	}
+
+	data := file.GetBytes()
+	specialSlots := map[int][]byte{
+		CDB_RequirementsHashOffset:    signature.Blobs[CSSLOT_REQUIREMENTS],
+		CDB_EntitlementsHashOffset:    signature.Blobs[CSSLOT_ENTITLEMENTS],
+		CDB_DerEntitlementsHashOffset: signature.Blobs[CSSLOT_DER_ENTITLEMENTS],
+	}
+	if options.CheckResources {
+		specialSlots[CDB_InfoFileHashOffset] = options.InfoFileBytes
+		specialSlots[CDB_CodeResourcesFileHashOffset] = options.CodeResourcesBytes
+	}
+	for _, codeDirectory := range signature.CodeDirectories {
+		name := fmt.Sprintf("code directory (hash type %d)", codeDirectory.HashType)
+		if codeDirectory.Ident != signature.Identifier() {
+			report.Fail("", "%s: identifier %q does not match %q", name, codeDirectory.Ident, signature.Identifier())
+		}
+		verifyCodeHashes(report, name, codeDirectory, data)
+		for slot := CDB_InfoFileHashOffset; slot <= CDB_DerEntitlementsHashOffset; slot++ {
+			if slotData, ok := specialSlots[slot]; ok {
+				verifySpecialHash(report, name, codeDirectory, slot, slotData)
+			}
+		}
+	}
+
+	if signature.IsAdHoc() {
+		return report
+	}
+	cmsBlob, ok := signature.Blobs[CSSLOT_SIGNATURESLOT]
+	if !ok || len(cmsBlob) <= 8 {
+		report.Fail("", "CMS signature is missing")
+		return report
+	}
+	chain, err := verifyCmsSignature(signature, cmsBlob[8:], options)
+	if err != nil {
+		report.Fail("", "CMS signature: %v", err)
+		return report
+	}
+	if chain != nil {
+		verifyDesignatedRequirement(report, signature, chain, options)
+	}
+	return report
+}
+
+// 签名必须满足自身的指定要求，Roots中的根证书作为Apple的根证书
+func verifyDesignatedRequirement(report *VerifyReport, signature *EmbeddedSignature, chain []*x509.Certificate, options *VerifyOptions) {
+	blob, ok := signature.Blobs[CSSLOT_REQUIREMENTS]
+	if !ok {
+		return
+	}
+	requirements := new(Requirements)
+	if !loadBlob(requirements, blob) {
+		report.Fail("", "invalid requirements blob")
+		return
+	}
+	var designated *Requirement
+	for i, key := range requirements.Keys {
+		if key == DesignatedRequirementType {
+			designated = requirements.Values[i]
+		}
+	}
+	if designated == nil {
+		return
+	}
+	ctx := &RequirementContext{
+		Certificates: chain,
+		AppleAnchors: chain[len(chain)-1:],
+		Identifier:   signature.Identifier(),
+		CDHashes:     signature.CDHashes(),
+	}
+	if len(options.InfoFileBytes) > 0 {
+		if _, err := plist.Unmarshal(options.InfoFileBytes, &ctx.InfoFile); err != nil {
+			report.Fail("", "Info.plist: %v", err)
+		}
+	}
+	if blob := signature.Blobs[CSSLOT_ENTITLEMENTS]; len(blob) > 8 {
+		if _, err := plist.Unmarshal(blob[8:], &ctx.Entitlements); err != nil {
+			report.Fail("", "entitlements: %v", err)
+		}
+	}
+	satisfied, err := designated.Evaluate(ctx)
+	if err != nil {
+		report.Fail("", "designated requirement: %v", err)
+	} else if !satisfied {
+		report.Fail("", "does not satisfy its designated requirement: %s", designated)
+	}
+}
+
+func verifyCodeHashes(report *VerifyReport, name string, codeDirectory *CodeDirectory, data []byte) {
+	codeLimit := int(codeDirectory.CodeLimit)
+	if codeLimit > len(data) {
+		report.Fail("", "%s: code limit %d exceeds file size %d", name, codeLimit, len(data))
+		return
+	}
+	pageSize := codeLimit
+	if codeDirectory.PageSizeLog2 != 0 {
+		pageSize = codeDirectory.GetPageSize()
+	}
+	hashes := ComputeHashes(codeDirectory.HashType, pageSize, data[:codeLimit])
+	if len(hashes) != len(codeDirectory.CodeHashes) {
+		report.Fail("", "%s: %d code pages, expected %d", name, len(codeDirectory.CodeHashes), len(hashes))
+		return
+	}
+	for i, hash := range hashes {
+		if !bytes.Equal(hash[:codeDirectory.HashSize], codeDirectory.CodeHashes[i]) {
+			report.Fail("", "%s: code page %d hash mismatch", name, i)
+		}
+	}
+}
+
+var specialSlotNames = map[int]string{
+	CDB_InfoFileHashOffset:          "Info.plist",
+	CDB_RequirementsHashOffset:      "requirements",
+	CDB_CodeResourcesFileHashOffset: "CodeResources",
+	CDB_EntitlementsHashOffset:      "entitlements",
+	CDB_DerEntitlementsHashOffset:   "DER entitlements",
+}
+
+// 数据为空时要求hash为0
+func verifySpecialHash(report *VerifyReport, name string, codeDirectory *CodeDirectory, slot int, data []byte) {
+	hash := codeDirectory.SpecialHash(slot)
+	if hash == nil {
+		if len(data) > 0 {
+			report.Fail("", "%s: %s is not sealed", name, specialSlotNames[slot])
+		}
+		return
+	}
+	expected := make([]byte, codeDirectory.HashSize)
+	if len(data) > 0 {
+		expected = ComputeHash(codeDirectory.HashType, data)[:codeDirectory.HashSize]
+	}
+	if !bytes.Equal(hash, expected) {
+		report.Fail("", "%s: %s hash mismatch", name, specialSlotNames[slot])
+	}
+}
+
+// 苹果开发者证书中的关键扩展，x509无法识别
+const appleCertificateExtensionPrefix = "1.2.840.113635.100.6."
+
+// 校验CMS签名，校验了证书链时返回证书链(叶子证书在前)
+func verifyCmsSignature(signature *EmbeddedSignature, der []byte, options *VerifyOptions)([]*x509.Certificate, error) {
+	ci, err := protocol.ParseContentInfo(der)
+	if err != nil {
+		return nil, err
+	}
+	sd, err := ci.SignedDataContent()
+	if err != nil {
+		return nil, err
+	}
+	codeDirectory := signature.codeDirectoryBlobs[0]
+	content, err := sd.EncapContentInfo.EContentValue()
+	if err != nil {
+		return nil, err
+	}
+	if content != nil && !bytes.Equal(content, codeDirectory) {
+		return nil, errors.New("signed content is not the code directory")
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("expected one signer, found %d", len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+	certs, err := sd.X509Certificates()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := si.FindCertificate(certs)
+	if err != nil {
+		return nil, err
+	}
+	if si.SignedAttrs == nil {
+		return nil, errors.New("signed attributes are missing")
+	}
+	hash, err := si.Hash()
+	if err != nil {
+		return nil, err
+	}
+	md := hash.New()
+	md.Write(codeDirectory)
+	digest, err := si.GetMessageDigestAttribute()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(digest, md.Sum(nil)) {
+		return nil, errors.New("message digest does not match the code directory")
+	}
+	signedMessage, err := marshalSignedAttributes(si.SignedAttrs)
+	if err != nil {
+		return nil, err
+	}
+	if err = cert.CheckSignature(si.X509SignatureAlgorithm(), signedMessage, si.Signature); err != nil {
+		return nil, err
+	}
+	if err = verifyCDHashesAttribute(signature, si.SignedAttrs); err != nil {
+		return nil, err
+	}
+
+	if options.Roots == nil {
+		return nil, nil
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range append(options.Intermediates, certs...) {
+		intermediates.AddCert(c)
+	}
+	var unhandled []asn1.ObjectIdentifier
+	for _, id := range cert.UnhandledCriticalExtensions {
+		if !strings.HasPrefix(id.String(), appleCertificateExtensionPrefix) {
+			unhandled = append(unhandled, id)
+		}
+	}
+	cert.UnhandledCriticalExtensions = unhandled
+	chains, err := cert.Verify(x509.VerifyOptions{
+		Roots:         options.Roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chains[0], nil
+}
+
+// 签名属性中的cdhash列表必须和CodeDirectory一致
+func verifyCDHashesAttribute(signature *EmbeddedSignature, attrs protocol.Attributes)error {
+	if !attrs.HasAttribute(AppleCDHashesOID) {
+		if len(signature.CodeDirectories) > 1 {
+			return errors.New("cdhashes attribute is missing")
+		}
+		return nil
+	}
+	rv, err := attrs.GetOnlyAttributeValueBytes(AppleCDHashesOID)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if _, err = asn1.Unmarshal(rv.FullBytes, &data); err != nil {
+		return err
+	}
+	var value struct {
+		CDHashes [][]byte `plist:"cdhashes"`
+	}
+	if _, err = plist.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	cdHashes := signature.CDHashes()
+	if len(value.CDHashes) != len(cdHashes) {
+		return errors.New("cdhashes attribute does not match the code directories")
+	}
+	for i, cdHash := range cdHashes {
+		if !bytes.Equal(value.CDHashes[i], cdHash) {
+			return errors.New("cdhashes attribute does not match the code directories")
+		}
+	}
+	return nil
+}
@@ -7,7 +7,6 @@ require (
 	github.com/mastahyeti/cms v0.0.7
 	github.com/sirupsen/logrus v1.4.2
 	github.com/youmark/pkcs8 v0.0.0-20181201043747-70daafe5d78a
-	go.mozilla.org/pkcs7 v0.0.0-20181213175627-3cffc6fbfe83
 	golang.org/x/crypto v0.0.0-20191029031824-8986dd9e96cf
 	golang.org/x/sys v0.0.0-20191029155521-f43be2a4598c // indirect
 	howett.net/plist v0.0.0-20181124034731-591f970eefbb
@@ -21,6 +21,11 @@ func(i *InfoFile)ExecutableName()string {
 	return ""
 }
 
+func(i *InfoFile)GetValue(key string)(interface{}, bool) {
+	value, ok := i.dict[key]
+	return value, ok
+}
+
 const bundleIdName = "CFBundleIdentifier"
 func(i *InfoFile) BundleId()string {
 	if name, ok := i.dict[bundleIdName]; ok {
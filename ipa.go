@@ -9,8 +9,6 @@ import (
 	"os"
 	"strings"
 
-	"golang.org/x/crypto/pkcs12"
-
 	"github.com/gamebtc/appsign/codesign"
 	"github.com/gamebtc/appsign/mach"
 )
@@ -21,13 +19,21 @@ const  InfoFileName = "Info.plist"
 const  ZipDirectorySeparator = "/"
 
 type ZipEntry struct {
-	Name  string //文件名
-	Data  []byte //解压后的数据
-	IsDir bool   //是否是目录
+	Name  string      //文件名
+	Data  []byte      //解压后的数据，符号链接为链接目标
+	IsDir bool        //是否是目录
+	Mode  os.FileMode //文件权限和类型，0表示未知
+}
+
+func(e *ZipEntry)IsSymlink()bool {
+	return e.Mode&os.ModeSymlink != 0
 }
 
 var  invalIdFile =  errors.New("invalid directory structure for IPA file")
 
+// 苹果根证书和WWDR证书所在目录
+var CertificateStorePath = ""
+
 type IpaFile struct {
 	srcFile          string
 	entries          []*ZipEntry
@@ -69,7 +75,7 @@ func(f *IpaFile)Load(zipFile string) error {
 				}
 			}
 		}
-		entries = append(entries, &ZipEntry{Name: file.Name, Data: bin, IsDir: isDir})
+		entries = append(entries, &ZipEntry{Name: file.Name, Data: bin, IsDir: isDir, Mode: file.FileHeader.Mode()})
 	}
 	if mobileProvision == nil {
 		return invalIdFile
@@ -100,13 +106,19 @@ func GetAppDirectoryPath(files []*zip.File) (string,error) {
 	return names[0], nil
 }
 
-func(f *IpaFile)GetFileBytes(name string)([]byte,error) {
-	path := f.appDirectoryPath + name
+func(f *IpaFile)getEntry(path string)*ZipEntry {
 	for i := 0; i < len(f.entries); i++ {
 		if f.entries[i].Name == path {
-			return f.entries[i].Data, nil
+			return f.entries[i]
 		}
 	}
+	return nil
+}
+
+func(f *IpaFile)GetFileBytes(name string)([]byte,error) {
+	if entry := f.getEntry(f.appDirectoryPath + name); entry != nil {
+		return entry.Data, nil
+	}
 	return nil, errors.New("not find file")
 }
 
@@ -142,16 +154,85 @@ func(f *IpaFile)GetBundleIdentifier()string {
 }
 
 func(f *IpaFile) ReplaceFile(name string, data []byte) {
-	path := f.appDirectoryPath + name
-	for i := 0; i < len(f.entries); i++ {
-		if f.entries[i].Name == path {
-			f.entries[i].Data = data
-			return
-		}
+	f.replaceEntry(f.appDirectoryPath+name, data)
+}
+
+func(f *IpaFile) replaceEntry(path string, data []byte) {
+	if entry := f.getEntry(path); entry != nil {
+		entry.Data = data
+		return
 	}
 	f.entries = append(f.entries, &ZipEntry{Name: path, Data: data, IsDir: false})
 }
 
+// 把动态库复制到主bundle的Frameworks目录，并在主程序中添加加载命令
+// 重签名时Frameworks目录下的动态库会和其他嵌套代码一起签名
+func(f *IpaFile)InjectDylib(name string, data []byte, weak bool)error {
+	if !strings.HasSuffix(name, dynamicLibraryExtension) || strings.Contains(name, ZipDirectorySeparator) {
+		return errors.New("invalid dylib name: " + name)
+	}
+	if !mach.IsMachObjectFile(data) && !mach.IsUniversalBinaryFile(data) {
+		return errors.New("not a Mach-O file: " + name)
+	}
+	infoFile, err := f.GetInfoFile()
+	if err != nil {
+		return err
+	}
+	entry := f.getEntry(f.appDirectoryPath + infoFile.ExecutableName())
+	if entry == nil {
+		return errors.New("not find file: " + infoFile.ExecutableName())
+	}
+	files, err := mach.ReadMachObjects(entry.Data)
+	if err != nil {
+		return errors.New(infoFile.ExecutableName() + ": " + err.Error())
+	}
+	for _, file := range files {
+		if err := file.AddDylib("@executable_path/Frameworks/"+name, weak); err != nil {
+			return err
+		}
+	}
+	entry.Data = mach.PackMachObjects(files)
+	f.ReplaceFile("Frameworks/"+name, data)
+	return nil
+}
+
+// 删除.app目录下所有Mach-O文件中的指定架构(如armv7)，之后需要重新签名
+func(f *IpaFile)RemoveArchitectures(names ...string)error {
+	removed := make(map[string]bool)
+	for _, name := range names {
+		if _, _, err := mach.ParseArchitecture(name); err != nil {
+			return err
+		}
+		removed[name] = true
+	}
+	for _, entry := range f.entries {
+		if entry.IsDir || entry.IsSymlink() || !strings.HasPrefix(entry.Name, f.appDirectoryPath) {
+			continue
+		}
+		if !mach.IsMachObjectFile(entry.Data) && !mach.IsUniversalBinaryFile(entry.Data) {
+			continue
+		}
+		files, err := mach.ReadMachObjects(entry.Data)
+		if err != nil {
+			return errors.New(entry.Name + ": " + err.Error())
+		}
+		var keep []*mach.MachObjectFile
+		for _, file := range files {
+			if !removed[file.ArchitectureName()] {
+				keep = append(keep, file)
+			}
+		}
+		if len(keep) == len(files) {
+			continue
+		}
+		if len(keep) == 0 {
+			return errors.New(entry.Name + ": cannot remove all architectures")
+		}
+		entry.Data = mach.PackMachObjects(keep)
+	}
+	return nil
+}
+
 func appleCertificateStore(path string) ([]*x509.Certificate, error) {
 	bin, err := ioutil.ReadFile(path + "AppleIncRootCertificate.cer")
 	if err != nil {
@@ -174,96 +255,159 @@ func appleCertificateStore(path string) ([]*x509.Certificate, error) {
 }
 
 func ResignIpa(f *IpaFile, mobileProvisionBytes, signCertBytes []byte, certPwd, outFile string) error {
-	privateKey, signCert, err := pkcs12.Decode(signCertBytes, certPwd)
-	if err != nil {
-		return err
-	}
-	var mobileProvision *MobileProvisionFile
-	if len(mobileProvisionBytes) == 0 {
-		mobileProvision = f.mobileProvision
-	} else {
-		mobileProvision, err = ParseMobileProvision(mobileProvisionBytes)
+	options := new(ResignOptions)
+	if len(mobileProvisionBytes) > 0 {
+		mobileProvision, err := ParseMobileProvision(mobileProvisionBytes)
 		if err != nil {
 			return err
 		}
+		options.MobileProvision = mobileProvision
 	}
+	return ResignIpaWithOptions(f, signCertBytes, certPwd, options, outFile)
+}
 
-	if mobileProvision.MatchingCertificate(signCert) == false {
-		return errors.New("the signing certificate given does not match any specified in the mobile provision file")
+func ResignIpaWithOptions(f *IpaFile, signCertBytes []byte, certPwd string, options *ResignOptions, outFile string) error {
+	identity, err := LoadSigningIdentity(signCertBytes, certPwd)
+	if err != nil {
+		return err
 	}
-	certificateStore, err := appleCertificateStore("")
-	if len(certificateStore) == 0 || err != nil {
-		return errors.New("failed to read certificate store")
+	// 复制选项，不修改调用者的MobileProvision
+	opts := ResignOptions{}
+	if options != nil {
+		opts = *options
 	}
-	certificateChain := append(certificateStore, signCert)
-	return f.ResignIPA(certificateChain, mobileProvision, privateKey.(crypto.Signer), outFile)
+	if opts.MobileProvision == nil {
+		opts.MobileProvision = f.mobileProvision
+	}
+	if opts.MobileProvision == nil {
+		return errors.New("missing mobile provision file")
+	}
+	for _, mobileProvision := range opts.mobileProvisions() {
+		if mobileProvision.MatchingCertificate(identity.Certificate()) == false {
+			return errors.New("the signing certificate given does not match any specified in the mobile provision file: " + mobileProvision.Name)
+		}
+	}
+	return f.ResignIPAWithOptions(identity.CertificateChain, identity.PrivateKey, &opts, outFile)
+}
+
+// ad-hoc签名，不需要证书，描述文件为空时使用各bundle中原有描述文件的权限
+func ResignIpaAdHoc(f *IpaFile, options *ResignOptions, outFile string) error {
+	opts := ResignOptions{}
+	if options != nil {
+		opts = *options
+	}
+	opts.AdHoc = true
+	return f.ResignIPAWithOptions(nil, nil, &opts, outFile)
 }
 
 func(f *IpaFile) ResignIPA(certChain []*x509.Certificate, mobileProvision *MobileProvisionFile, privateKey crypto.Signer, outFile string)error {
-	infoFile, err := f.GetInfoFile()
-	if err != nil {
-		return err
+	return f.ResignIPAWithOptions(certChain, privateKey, &ResignOptions{MobileProvision: mobileProvision}, outFile)
+}
+
+// 包含FairPlay加密的Mach-O(如从App Store下载的IPA)，需要先解密才能重签名
+type EncryptedError struct {
+	Paths []string // 加密文件在IPA中的路径
+}
+
+func(e *EncryptedError)Error()string {
+	return "encrypted Mach-O files must be decrypted before resigning: " + strings.Join(e.Paths, ", ")
+}
+
+// .app目录下所有加密的Mach-O文件，包括Frameworks和扩展中的文件
+// Mach-O文件无法解析时返回错误
+func(f *IpaFile)EncryptedMachOs()([]string, error) {
+	var paths []string
+	for _, entry := range f.entries {
+		if entry.IsDir || entry.IsSymlink() || !strings.HasPrefix(entry.Name, f.appDirectoryPath) {
+			continue
+		}
+		if !mach.IsMachObjectFile(entry.Data) && !mach.IsUniversalBinaryFile(entry.Data) {
+			continue
+		}
+		files, err := mach.ReadMachObjects(entry.Data)
+		if err != nil {
+			return nil, errors.New(entry.Name + ": " + err.Error())
+		}
+		for _, file := range files {
+			if file.IsEncrypted() {
+				paths = append(paths, entry.Name)
+				break
+			}
+		}
 	}
+	return paths, nil
+}
 
-	exeName := infoFile.ExecutableName()
-	buffer, err := f.GetFileBytes(exeName)
+// 对主bundle及其中嵌套的Frameworks、PlugIns、Watch等代码重新签名
+// options.AdHoc时certChain和privateKey可以为nil
+func(f *IpaFile) ResignIPAWithOptions(certChain []*x509.Certificate, privateKey crypto.Signer, options *ResignOptions, outFile string)error {
+	if options == nil {
+		options = new(ResignOptions)
+	}
+	if !options.AdHoc && len(certChain) == 0 {
+		return errors.New("missing signing certificate")
+	}
+	encrypted, err := f.EncryptedMachOs()
 	if err != nil {
 		return err
 	}
-
-	bundleId := mobileProvision.BundleIdentifier()
-	infoFile.ReplaceBundleId(bundleId)
-
-	infoFileBytes, err := infoFile.Marshal()
-	if err != nil {
+	if len(encrypted) > 0 {
+		if !options.AllowEncrypted {
+			return &EncryptedError{Paths: encrypted}
+		}
+		for _, path := range encrypted {
+			options.warn(path + " is encrypted, the resigned app will not launch")
+		}
+	}
+	signer := newBundleSigner(f, certChain, privateKey, options)
+	if _, _, err := signer.signBundle(f.GetBundle()); err != nil {
 		return err
 	}
+	return f.Save(outFile)
+}
+
+func(f *IpaFile) WriteNewFile(mobileProvision *MobileProvisionFile, infoFileBytes, codeResBytes, execBytes []byte, execName, outFile string) error {
+	f.ReplaceFile(MobileProvisionFileName, mobileProvision.raw)
+	f.ReplaceFile(CodeResourcesFilePath, codeResBytes)
+	f.ReplaceFile(InfoFileName, infoFileBytes)
+	f.ReplaceFile(execName, execBytes)
+	return f.Save(outFile)
+}
 
-	codeRes, err := f.GetCodeResourcesFile()
+func(f *IpaFile) Save(outFile string) error {
+	d, err := os.Create(outFile)
 	if err != nil {
 		return err
 	}
-	codeRes.UpdateFileHash(InfoFileName, infoFileBytes)
-	codeRes.UpdateFileHash(MobileProvisionFileName, mobileProvision.raw)
-	codeResBytes, err := codeRes.Marshal()
-	if err != nil {
-		return err
+	zw := zip.NewWriter(d)
+	err = f.writeEntries(zw)
+	// zip的目录在Close时写入，Close的错误同样表示文件不完整，返回第一个错误
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
 	}
-
-	files := mach.ReadMachObjects(buffer)
-	for _, file := range files {
-		codesign.ResignExecutable(file, bundleId, certChain, privateKey, infoFileBytes, codeResBytes, mobileProvision.Entitlements)
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
 	}
-	execBytes := mach.PackMachObjects(files)
-	return f.WriteNewFile(mobileProvision, infoFileBytes, codeResBytes, execBytes, infoFile.ExecutableName(), outFile)
+	return err
 }
 
-func(f *IpaFile) WriteNewFile(mobileProvision *MobileProvisionFile, infoFileBytes, codeResBytes, execBytes []byte, execName, outFile string) error {
-	d, _ := os.Create(outFile)
-	defer d.Close()
-	zw := zip.NewWriter(d)
-	defer zw.Close()
-	execPath := f.appDirectoryPath + execName
-	embedded := f.appDirectoryPath + MobileProvisionFileName
-	codeResPath := f.appDirectoryPath + CodeResourcesFilePath
-	infoPath := f.appDirectoryPath + InfoFileName
+func(f *IpaFile) writeEntries(zw *zip.Writer) error {
 	for _, file := range f.entries {
-		writer, err := zw.Create(file.Name)
+		header := &zip.FileHeader{Name: file.Name, Method: zip.Deflate}
+		if file.IsDir {
+			header.Method = zip.Store
+		}
+		if file.Mode != 0 {
+			// 保留可执行权限和符号链接
+			header.SetMode(file.Mode)
+		}
+		writer, err := zw.CreateHeader(header)
 		if err != nil {
 			return err
 		}
 		if file.IsDir == false {
-			switch file.Name {
-			case embedded:
-				writer.Write(mobileProvision.raw)
-			case codeResPath:
-				writer.Write(codeResBytes)
-			case infoPath:
-				writer.Write(infoFileBytes)
-			case execPath:
-				writer.Write(execBytes)
-			default:
-				writer.Write(file.Data)
+			if _, err = writer.Write(file.Data); err != nil {
+				return err
 			}
 		}
 	}
@@ -0,0 +1,147 @@
+package mach
+
+import (
+	"errors"
+	"fmt"
+)
+
+const(
+	CpuTypeArm64_32 = 0x0200000C // CPU_TYPE_ARM64_32
+	CpuSubTypeMask = 0xff000000  // CPU_SUBTYPE_MASK，高8位为capability，如arm64e的PTRAUTH_ABI
+)
+
+// 架构名称，同 lipo -archs
+type architecture struct {
+	name       string
+	cpuType    uint32
+	cpuSubType uint32
+}
+
+var architectures = []architecture{
+	{"i386", CpuTypeI386, 3},
+	{"x86_64", CpuTypeCPU_TYPE_X86_64, 3},
+	{"x86_64h", CpuTypeCPU_TYPE_X86_64, 8},
+	{"armv6", CpuTypeArm, 6},
+	{"armv7", CpuTypeArm, 9},
+	{"armv7f", CpuTypeArm, 10},
+	{"armv7s", CpuTypeArm, 11},
+	{"armv7k", CpuTypeArm, 12},
+	{"armv6m", CpuTypeArm, 14},
+	{"armv7m", CpuTypeArm, 15},
+	{"armv7em", CpuTypeArm, 16},
+	{"arm64", CpuTypeArm64, 0},
+	{"arm64v8", CpuTypeArm64, 1},
+	{"arm64e", CpuTypeArm64, 2},
+	{"arm64_32", CpuTypeArm64_32, 1},
+	{"ppc", CpuTypePowerPC, 0},
+	{"ppc64", CpuTypePowerPC64, 0},
+}
+
+// CPU类型对应的名称，如arm64、arm64e、armv7，未知的类型返回 cputype(x) cpusubtype(y)
+func ArchitectureName(cpuType, cpuSubType uint32)string {
+	cpuSubType &^= CpuSubTypeMask
+	for _, arch := range architectures {
+		if arch.cpuType == cpuType && arch.cpuSubType == cpuSubType {
+			return arch.name
+		}
+	}
+	return fmt.Sprintf("cputype(%d) cpusubtype(%d)", cpuType, cpuSubType)
+}
+
+// 名称对应的CPU类型
+func ParseArchitecture(name string)(cpuType, cpuSubType uint32, err error) {
+	for _, arch := range architectures {
+		if arch.name == name {
+			return arch.cpuType, arch.cpuSubType, nil
+		}
+	}
+	return 0, 0, errors.New("unknown architecture: " + name)
+}
+
+func(m *MachObjectFile)ArchitectureName()string {
+	return ArchitectureName(m.Header.CpuType, m.Header.CpuSubType)
+}
+
+// 在universal文件中的默认对齐，ARM使用16K页，其他使用4K页
+func ArchitectureAlignment(cpuType uint32)uint32 {
+	switch cpuType {
+	case CpuTypeArm, CpuTypeArm64, CpuTypeArm64_32:
+		return 1 << 14
+	}
+	return 1 << 12
+}
+
+// 所有架构的名称
+func ArchitectureNames(files []*MachObjectFile)[]string {
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = file.ArchitectureName()
+	}
+	return names
+}
+
+// 查找指定的架构，同 lipo -thin，返回的架构没有FatArch，写入时为单架构文件
+func ExtractArchitecture(files []*MachObjectFile, name string)(*MachObjectFile, error) {
+	if _, _, err := ParseArchitecture(name); err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.ArchitectureName() == name {
+			thin := *file
+			thin.FatArch = nil
+			return &thin, nil
+		}
+	}
+	return nil, errors.New("architecture not found: " + name)
+}
+
+// 删除指定的架构，同 lipo -remove，不能删除所有架构
+func RemoveArchitectures(files []*MachObjectFile, names ...string)([]*MachObjectFile, error) {
+	removed := make(map[string]bool)
+	for _, name := range names {
+		if _, err := ExtractArchitecture(files, name); err != nil {
+			return nil, err
+		}
+		removed[name] = true
+	}
+	var result []*MachObjectFile
+	for _, file := range files {
+		if !removed[file.ArchitectureName()] {
+			result = append(result, file)
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New("cannot remove all architectures")
+	}
+	return result, nil
+}
+
+// 合并多个Mach-O为universal文件，同 lipo -create，架构不能重复
+// 单架构文件使用架构的默认对齐，结果总是写为universal文件
+func MergeMachObjects(files ...[]*MachObjectFile)([]*MachObjectFile, error) {
+	var result []*MachObjectFile
+	seen := make(map[string]bool)
+	for _, items := range files {
+		for _, file := range items {
+			name := file.ArchitectureName()
+			if seen[name] {
+				return nil, errors.New("duplicate architecture: " + name)
+			}
+			seen[name] = true
+			if file.FatArch == nil {
+				fat := *file
+				fat.FatArch = &FatArch{
+					CpuType:    file.Header.CpuType,
+					CpuSubType: file.Header.CpuSubType,
+					Align:      ArchitectureAlignment(file.Header.CpuType),
+				}
+				file = &fat
+			}
+			result = append(result, file)
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New("no architectures to merge")
+	}
+	return result, nil
+}
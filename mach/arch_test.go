@@ -0,0 +1,135 @@
+package mach
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func testThinMachObject(t *testing.T, is64Bit bool, name string)*MachObjectFile {
+	cpuType, cpuSubType, err := ParseArchitecture(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := testMachObject(is64Bit, cpuType)
+	file.Header.CpuSubType = cpuSubType
+	return file
+}
+
+func TestMergeMachObjects(t *testing.T) {
+	thins := []*MachObjectFile{
+		testThinMachObject(t, false, "armv7"),
+		testThinMachObject(t, true, "arm64"),
+		testThinMachObject(t, true, "x86_64"),
+	}
+	merged, err := MergeMachObjects(thins[:1], thins[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := PackMachObjects(merged)
+	if !IsUniversalBinaryFile(data) {
+		t.Fatalf("merged file is not a universal Mach-O")
+	}
+	files, err := ReadMachObjects(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := ArchitectureNames(files); !reflect.DeepEqual(names, []string{"armv7", "arm64", "x86_64"}) {
+		t.Fatalf("merged architectures %v", names)
+	}
+	for i, file := range files {
+		align := ArchitectureAlignment(file.Header.CpuType)
+		if file.FatArch.Align != align || file.FatArch.Offset%uint64(align) != 0 {
+			t.Errorf("%s: offset 0x%x align 0x%x, expected alignment 0x%x", file.ArchitectureName(),
+				file.FatArch.Offset, file.FatArch.Align, align)
+		}
+		if !bytes.Equal(file.GetBytes(), thins[i].GetBytes()) {
+			t.Errorf("%s: slice content changed", file.ArchitectureName())
+		}
+	}
+	if ArchitectureAlignment(CpuTypeArm64) != 1<<14 || ArchitectureAlignment(CpuTypeCPU_TYPE_X86_64) != 1<<12 {
+		t.Errorf("unexpected default alignments")
+	}
+
+	// 从universal文件中取出单个架构
+	for i, name := range []string{"armv7", "arm64", "x86_64"} {
+		thin, err := ExtractArchitecture(files, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if thin.FatArch != nil || !bytes.Equal(PackMachObjects([]*MachObjectFile{thin}), thins[i].GetBytes()) {
+			t.Errorf("%s: extracted architecture is not the original thin file", name)
+		}
+	}
+	if files[1].FatArch == nil {
+		t.Errorf("extracting an architecture changed the universal file")
+	}
+	if _, err := ExtractArchitecture(files, "arm64e"); err == nil {
+		t.Errorf("extracting a missing architecture: expected an error")
+	}
+	if _, err := ExtractArchitecture(files, "sparc"); err == nil {
+		t.Errorf("extracting an unknown architecture: expected an error")
+	}
+
+	// 重复的架构
+	if _, err := MergeMachObjects(files, thins[1:2]); err == nil {
+		t.Errorf("merging a duplicate arm64: expected an error")
+	}
+	if _, err := MergeMachObjects(thins[1:2], []*MachObjectFile{testThinMachObject(t, true, "arm64")}); err == nil {
+		t.Errorf("merging two arm64 thin files: expected an error")
+	}
+	// 相同的CPU类型、不同的子类型可以合并
+	arm64e := testThinMachObject(t, true, "arm64e")
+	if merged, err = MergeMachObjects(thins[1:2], []*MachObjectFile{arm64e}); err != nil {
+		t.Errorf("merging arm64 and arm64e: %v", err)
+	} else if names := ArchitectureNames(merged); !reflect.DeepEqual(names, []string{"arm64", "arm64e"}) {
+		t.Errorf("merged architectures %v", names)
+	}
+	if _, err := MergeMachObjects(); err == nil {
+		t.Errorf("merging nothing: expected an error")
+	}
+}
+
+func TestRemoveArchitectures(t *testing.T) {
+	merged, err := MergeMachObjects([]*MachObjectFile{
+		testThinMachObject(t, false, "armv7"),
+		testThinMachObject(t, true, "arm64"),
+		testThinMachObject(t, true, "x86_64"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := ReadMachObjects(PackMachObjects(merged))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remaining, err := RemoveArchitectures(files, "armv7", "x86_64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := ArchitectureNames(remaining); !reflect.DeepEqual(names, []string{"arm64"}) {
+		t.Fatalf("remaining architectures %v", names)
+	}
+	// 剩下一个架构时仍然是universal文件，对齐不变
+	read, err := ReadMachObjects(PackMachObjects(remaining))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 1 || read[0].FatArch == nil || read[0].FatArch.Align != 1<<14 || read[0].FatArch.Offset != 1<<14 {
+		t.Errorf("remaining arm64 slice is not aligned in a universal file")
+	}
+	if len(files) != 3 {
+		t.Errorf("removing architectures changed the input")
+	}
+
+	if _, err := RemoveArchitectures(remaining, "arm64"); err == nil {
+		t.Errorf("removing the last architecture: expected an error")
+	}
+	if _, err := RemoveArchitectures(files, "armv7", "arm64", "x86_64"); err == nil {
+		t.Errorf("removing all architectures: expected an error")
+	}
+	if _, err := RemoveArchitectures(files, "arm64e"); err == nil {
+		t.Errorf("removing a missing architecture: expected an error")
+	}
+}
@@ -0,0 +1,112 @@
+package mach
+
+import (
+	"errors"
+)
+
+// 签名数据的偏移和长度按16字节对齐
+const CodeSignatureAlignment = 16
+
+func alignUp(value, align uint64)uint64 {
+	return (value + align - 1) / align * align
+}
+
+// 段(如__TEXT、__LINKEDIT)在文件中的范围
+func segmentRange(segment Entity)(offset, size uint64) {
+	switch s := segment.(type) {
+	case *SegmentCommand32:
+		return uint64(s.FileOffset), uint64(s.FileSize)
+	case *SegmentCommand64:
+		return s.FileOffset, s.FileSize
+	}
+	return 0, 0
+}
+
+// __TEXT在文件中的范围，即CodeDirectory的可执行段，没有__TEXT时返回0
+func(m *MachObjectFile)TextSegmentRange()(offset, size uint64) {
+	return segmentRange(FindTextSegment(m.LoadCommands))
+}
+
+// 返回LC_CODE_SIGNATURE，没有签名时在header的空闲空间中添加，签名数据放在__LINKEDIT的末尾
+func(m *MachObjectFile)PrepareCodeSignature()(*CodeSignatureCommand, error) {
+	linkEdit := FindLinkEditSegment(m.LoadCommands)
+	if linkEdit == nil {
+		return nil, errors.New("LinkEdit segment was not found")
+	}
+	offset, size := segmentRange(linkEdit)
+	if command, ok := m.GetLoadCommand(LC_CodeSignature).(*CodeSignatureCommand); ok {
+		if uint64(command.DataOffset) < offset {
+			return nil, errors.New("code signature is not in the LinkEdit segment")
+		}
+		return command, nil
+	}
+	end := offset + size
+	if end != uint64(m.Length()) {
+		return nil, errors.New("LinkEdit segment is not at the end of the file")
+	}
+	command := &CodeSignatureCommand{DataOffset: uint32(alignUp(end, CodeSignatureAlignment))}
+	if err := m.AddLoadCommand(command); err != nil {
+		return nil, err
+	}
+	return command, nil
+}
+
+// 为签名数据重新分配size字节的空间(按16字节对齐)，原有的签名数据被清除
+// 更新LC_CODE_SIGNATURE的长度和__LINKEDIT的FileSize，VMSize按页对齐
+func(m *MachObjectFile)ReserveCodeSignature(size int)error {
+	command, err := m.PrepareCodeSignature()
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		return errors.New("invalid code signature size")
+	}
+	dataSize := alignUp(uint64(size), CodeSignatureAlignment)
+	end := uint64(command.DataOffset) + dataSize
+	if end > 0xffffffff {
+		return errors.New("code signature is too large")
+	}
+	codeLength := int(command.DataOffset) - m.DataOffset
+	if codeLength < 0 {
+		return errors.New("code signature overlaps the load commands")
+	}
+	// 总是复制，不修改原来的文件数据
+	data := make([]byte, codeLength+int(dataSize))
+	if codeLength <= len(m.Data) {
+		copy(data, m.Data[:codeLength])
+	} else {
+		copy(data, m.Data)
+	}
+	m.Data = data
+	command.DataSize = uint32(dataSize)
+
+	pageSize := uint64(ArchitectureAlignment(m.Header.CpuType))
+	switch segment := FindLinkEditSegment(m.LoadCommands).(type) {
+	case *SegmentCommand32:
+		segment.FileSize = uint32(end - uint64(segment.FileOffset))
+		segment.VMSize = uint32(alignUp(uint64(segment.FileSize), pageSize))
+	case *SegmentCommand64:
+		segment.FileSize = end - segment.FileOffset
+		segment.VMSize = alignUp(segment.FileSize, pageSize)
+	}
+	return nil
+}
+
+// 写入签名数据，需要先调用ReserveCodeSignature，剩余的空间填充0
+func(m *MachObjectFile)WriteCodeSignature(signature []byte)error {
+	command, ok := m.GetLoadCommand(LC_CodeSignature).(*CodeSignatureCommand)
+	if !ok {
+		return errors.New("code signature was not found")
+	}
+	if len(signature) > int(command.DataSize) {
+		return errors.New("code signature is larger than the reserved space")
+	}
+	offset := int(command.DataOffset) - m.DataOffset
+	if offset < 0 || offset+int(command.DataSize) > len(m.Data) {
+		return errors.New("code signature is out of range")
+	}
+	area := m.Data[offset : offset+int(command.DataSize)]
+	n := copy(area, signature)
+	copy(area[n:], make([]byte, len(area)-n))
+	return nil
+}
@@ -0,0 +1,653 @@
+package mach
+
+import (
+	"encoding/binary"
+)
+
+// 命令中的字符串(lc_str)，offset为相对命令开始的偏移
+func readCommandString(buffer []byte, offset uint32)string {
+	if int(offset) >= len(buffer) {
+		return ""
+	}
+	data := buffer[offset:]
+	for i, c := range data {
+		if c == 0 {
+			return string(data[:i])
+		}
+	}
+	return string(data)
+}
+
+// 字符串之后填充0，使命令长度按align对齐
+func commandStringSize(fixedSize int, s string, align int)uint32 {
+	size := fixedSize + len(s) + 1
+	return uint32((size + align - 1) / align * align)
+}
+
+// LC_LOAD_DYLIB、LC_ID_DYLIB、LC_LOAD_WEAK_DYLIB、LC_REEXPORT_DYLIB等
+const DylibCommandSize = 24
+type DylibCommand struct {
+	commandType          uint32
+	CommandSize          uint32
+	Name                 string
+	Timestamp            uint32
+	CurrentVersion       uint32
+	CompatibilityVersion uint32
+}
+
+func NewDylibCommand(commandType uint32, name string, currentVersion, compatibilityVersion uint32, is64Bit bool)*DylibCommand {
+	align := 4
+	if is64Bit {
+		align = 8
+	}
+	return &DylibCommand{
+		commandType:          commandType,
+		CommandSize:          commandStringSize(DylibCommandSize, name, align),
+		Name:                 name,
+		Timestamp:            2,
+		CurrentVersion:       currentVersion,
+		CompatibilityVersion: compatibilityVersion,
+	}
+}
+
+func(c *DylibCommand)Load(buffer []byte) int {
+	c.commandType = binary.LittleEndian.Uint32(buffer)
+	c.CommandSize = binary.LittleEndian.Uint32(buffer[4:])
+	c.Name = readCommandString(buffer[:c.CommandSize], binary.LittleEndian.Uint32(buffer[8:]))
+	c.Timestamp = binary.LittleEndian.Uint32(buffer[12:])
+	c.CurrentVersion = binary.LittleEndian.Uint32(buffer[16:])
+	c.CompatibilityVersion = binary.LittleEndian.Uint32(buffer[20:])
+	return int(c.CommandSize)
+}
+
+func(c *DylibCommand)WriteBytes(buffer []byte) int {
+	binary.LittleEndian.PutUint32(buffer, c.commandType)
+	length := c.Length()
+	binary.LittleEndian.PutUint32(buffer[4:], uint32(length))
+	binary.LittleEndian.PutUint32(buffer[8:], DylibCommandSize)
+	binary.LittleEndian.PutUint32(buffer[12:], c.Timestamp)
+	binary.LittleEndian.PutUint32(buffer[16:], c.CurrentVersion)
+	binary.LittleEndian.PutUint32(buffer[20:], c.CompatibilityVersion)
+	n := copy(buffer[DylibCommandSize:length], c.Name)
+	copy(buffer[DylibCommandSize+n:length], make([]byte, length-DylibCommandSize-n))
+	return length
+}
+
+func(c *DylibCommand)GetBytes()[]byte {
+	buffer := make([]byte, c.Length())
+	c.WriteBytes(buffer)
+	return buffer
+}
+
+// 名称(包括结尾的0)超出CommandSize时按8字节对齐增长，写入时不会截断
+func(c *DylibCommand)Length() int {
+	if int(c.CommandSize) < DylibCommandSize+len(c.Name)+1 {
+		return int(commandStringSize(DylibCommandSize, c.Name, 8))
+	}
+	return int(c.CommandSize)
+}
+
+func(c *DylibCommand)Type() int {
+	return int(c.commandType)
+}
+
+// LC_LOAD_DYLINKER、LC_ID_DYLINKER
+const DylinkerCommandSize = 12
+type DylinkerCommand struct {
+	commandType uint32
+	CommandSize uint32
+	Name        string
+}
+
+func(c *DylinkerCommand)Load(buffer []byte) int {
+	c.commandType = binary.LittleEndian.Uint32(buffer)
+	c.CommandSize = binary.LittleEndian.Uint32(buffer[4:])
+	c.Name = readCommandString(buffer[:c.CommandSize], binary.LittleEndian.Uint32(buffer[8:]))
+	return int(c.CommandSize)
+}
+
+func(c *DylinkerCommand)WriteBytes(buffer []byte) int {
+	binary.LittleEndian.PutUint32(buffer, c.commandType)
+	length := c.Length()
+	binary.LittleEndian.PutUint32(buffer[4:], uint32(length))
+	binary.LittleEndian.PutUint32(buffer[8:], DylinkerCommandSize)
+	n := copy(buffer[DylinkerCommandSize:length], c.Name)
+	copy(buffer[DylinkerCommandSize+n:length], make([]byte, length-DylinkerCommandSize-n))
+	return length
+}
+
+func(c *DylinkerCommand)GetBytes()[]byte {
+	buffer := make([]byte, c.Length())
+	c.WriteBytes(buffer)
+	return buffer
+}
+
+// 名称(包括结尾的0)超出CommandSize时按8字节对齐增长，写入时不会截断
+func(c *DylinkerCommand)Length() int {
+	if int(c.CommandSize) < DylinkerCommandSize+len(c.Name)+1 {
+		return int(commandStringSize(DylinkerCommandSize, c.Name, 8))
+	}
+	return int(c.CommandSize)
+}
+
+func(c *DylinkerCommand)Type() int {
+	return int(c.commandType)
+}
+
+// LC_RPATH
+const RunPathCommandSize = 12
+type RunPathCommand struct {
+	CommandSize uint32
+	Path        string
+}
+
+func NewRunPathCommand(path string, is64Bit bool)*RunPathCommand {
+	align := 4
+	if is64Bit {
+		align = 8
+	}
+	return &RunPathCommand{
+		CommandSize: commandStringSize(RunPathCommandSize, path, align),
+		Path:        path,
+	}
+}
+
+func(c *RunPathCommand)Load(buffer []byte) int {
+	c.CommandSize = binary.LittleEndian.Uint32(buffer[4:])
+	c.Path = readCommandString(buffer[:c.CommandSize], binary.LittleEndian.Uint32(buffer[8:]))
+	return int(c.CommandSize)
+}
+
+func(c *RunPathCommand)WriteBytes(buffer []byte) int {
+	binary.LittleEndian.PutUint32(buffer, LC_RunPath)
+	length := c.Length()
+	binary.LittleEndian.PutUint32(buffer[4:], uint32(length))
+	binary.LittleEndian.PutUint32(buffer[8:], RunPathCommandSize)
+	n := copy(buffer[RunPathCommandSize:length], c.Path)
+	copy(buffer[RunPathCommandSize+n:length], make([]byte, length-RunPathCommandSize-n))
+	return length
+}
+
+func(c *RunPathCommand)GetBytes()[]byte {
+	buffer := make([]byte, c.Length())
+	c.WriteBytes(buffer)
+	return buffer
+}
+
+// 路径(包括结尾的0)超出CommandSize时按8字节对齐增长，写入时不会截断
+func(c *RunPathCommand)Length() int {
+	if int(c.CommandSize) < RunPathCommandSize+len(c.Path)+1 {
+		return int(commandStringSize(RunPathCommandSize, c.Path, 8))
+	}
+	return int(c.CommandSize)
+}
+
+func(c *RunPathCommand)Type() int {
+	return LC_RunPath
+}
+
+// LC_UUID
+const UUIDCommandSize = 24
+type UUIDCommand struct {
+	UUID [16]byte
+}
+
+func(c *UUIDCommand)Load(buffer []byte) int {
+	copy(c.UUID[:], buffer[8:24])
+	return UUIDCommandSize
+}
+
+func(c *UUIDCommand)WriteBytes(buffer []byte) int {
+	binary.LittleEndian.PutUint32(buffer, LC_UUID)
+	binary.LittleEndian.PutUint32(buffer[4:], UUIDCommandSize)
+	copy(buffer[8:24], c.UUID[:])
+	return UUIDCommandSize
+}
+
+func(c *UUIDCommand)GetBytes()[]byte {
+	buffer := make([]byte, UUIDCommandSize)
+	c.WriteBytes(buffer)
+	return buffer
+}
+
+func(c *UUIDCommand)Length() int {
+	return UUIDCommandSize
+}
+
+func(c *UUIDCommand)Type() int {
+	return LC_UUID
+}
+
+// LC_ENCRYPTION_INFO、LC_ENCRYPTION_INFO_64
+const EncryptionInfoCommandSize = 20
+const EncryptionInfoCommand64Size = 24
+type EncryptionInfoCommand struct {
+	Is64Bit     bool
+	CryptOffset uint32 // 加密数据的文件偏移
+	CryptSize   uint32
+	CryptID     uint32 // 0表示没有加密
+	Pad         uint32 // 64-Bit only
+}
+
+func(c *EncryptionInfoCommand)Load(buffer []byte) int {
+	c.Is64Bit = binary.LittleEndian.Uint32(buffer) == LC_EncryptionInfo64
+	c.CryptOffset = binary.LittleEndian.Uint32(buffer[8:])
+	c.CryptSize = binary.LittleEndian.Uint32(buffer[12:])
+	c.CryptID = binary.LittleEndian.Uint32(buffer[16:])
+	if c.Is64Bit {
+		c.Pad = binary.LittleEndian.Uint32(buffer[20:])
+	}
+	return c.Length()
+}
+
+func(c *EncryptionInfoCommand)WriteBytes(buffer []byte) int {
+	binary.LittleEndian.PutUint32(buffer, uint32(c.Type()))
+	binary.LittleEndian.PutUint32(buffer[4:], uint32(c.Length()))
+	binary.LittleEndian.PutUint32(buffer[8:], c.CryptOffset)
+	binary.LittleEndian.PutUint32(buffer[12:], c.CryptSize)
+	binary.LittleEndian.PutUint32(buffer[16:], c.CryptID)
+	if c.Is64Bit {
+		binary.LittleEndian.PutUint32(buffer[20:], c.Pad)
+	}
+	return c.Length()
+}
+
+func(c *EncryptionInfoCommand)GetBytes()[]byte {
+	buffer := make([]byte, c.Length())
+	c.WriteBytes(buffer)
+	return buffer
+}
+
+func(c *EncryptionInfoCommand)Length() int {
+	if c.Is64Bit {
+		return EncryptionInfoCommand64Size
+	}
+	return EncryptionInfoCommandSize
+}
+
+func(c *EncryptionInfoCommand)Type() int {
+	if c.Is64Bit {
+		return LC_EncryptionInfo64
+	}
+	return LC_EncryptionInfo
+}
+
+// LC_VERSION_MIN_MACOSX、LC_VERSION_MIN_IPHONEOS、LC_VERSION_MIN_TVOS、LC_VERSION_MIN_WATCHOS
+// 版本号为 xxxx.yy.zz 格式
+const VersionMinCommandSize = 16
+type VersionMinCommand struct {
+	commandType uint32
+	Version     uint32
+	SDK         uint32
+}
+
+func(c *VersionMinCommand)Load(buffer []byte) int {
+	c.commandType = binary.LittleEndian.Uint32(buffer)
+	c.Version = binary.LittleEndian.Uint32(buffer[8:])
+	c.SDK = binary.LittleEndian.Uint32(buffer[12:])
+	return VersionMinCommandSize
+}
+
+func(c *VersionMinCommand)WriteBytes(buffer []byte) int {
+	binary.LittleEndian.PutUint32(buffer, c.commandType)
+	binary.LittleEndian.PutUint32(buffer[4:], VersionMinCommandSize)
+	binary.LittleEndian.PutUint32(buffer[8:], c.Version)
+	binary.LittleEndian.PutUint32(buffer[12:], c.SDK)
+	return VersionMinCommandSize
+}
+
+func(c *VersionMinCommand)GetBytes()[]byte {
+	buffer := make([]byte, VersionMinCommandSize)
+	c.WriteBytes(buffer)
+	return buffer
+}
+
+func(c *VersionMinCommand)Length() int {
+	return VersionMinCommandSize
+}
+
+func(c *VersionMinCommand)Type() int {
+	return int(c.commandType)
+}
+
+const(
+	PlatformMacOS = 1       // PLATFORM_MACOS
+	PlatformIOS = 2         // PLATFORM_IOS
+	PlatformTvOS = 3        // PLATFORM_TVOS
+	PlatformWatchOS = 4     // PLATFORM_WATCHOS
+	PlatformIOSSimulator = 7 // PLATFORM_IOSSIMULATOR
+)
+
+type BuildToolVersion struct {
+	Tool    uint32
+	Version uint32
+}
+
+// LC_BUILD_VERSION
+const BuildVersionCommandSize = 24
+type BuildVersionCommand struct {
+	Platform uint32
+	MinOS    uint32 // xxxx.yy.zz
+	SDK      uint32 // xxxx.yy.zz
+	//NumberOfTools uint32
+	Tools    []BuildToolVersion
+}
+
+func(c *BuildVersionCommand)Load(buffer []byte) int {
+	c.Platform = binary.LittleEndian.Uint32(buffer[8:])
+	c.MinOS = binary.LittleEndian.Uint32(buffer[12:])
+	c.SDK = binary.LittleEndian.Uint32(buffer[16:])
+	n := int(binary.LittleEndian.Uint32(buffer[20:]))
+	for i := 0; i < n; i++ {
+		offset := BuildVersionCommandSize + i*8
+		c.Tools = append(c.Tools, BuildToolVersion{
+			Tool:    binary.LittleEndian.Uint32(buffer[offset:]),
+			Version: binary.LittleEndian.Uint32(buffer[offset+4:]),
+		})
+	}
+	return c.Length()
+}
+
+func(c *BuildVersionCommand)WriteBytes(buffer []byte) int {
+	binary.LittleEndian.PutUint32(buffer, LC_BuildVersion)
+	binary.LittleEndian.PutUint32(buffer[4:], uint32(c.Length()))
+	binary.LittleEndian.PutUint32(buffer[8:], c.Platform)
+	binary.LittleEndian.PutUint32(buffer[12:], c.MinOS)
+	binary.LittleEndian.PutUint32(buffer[16:], c.SDK)
+	binary.LittleEndian.PutUint32(buffer[20:], uint32(len(c.Tools)))
+	for i, tool := range c.Tools {
+		offset := BuildVersionCommandSize + i*8
+		binary.LittleEndian.PutUint32(buffer[offset:], tool.Tool)
+		binary.LittleEndian.PutUint32(buffer[offset+4:], tool.Version)
+	}
+	return c.Length()
+}
+
+func(c *BuildVersionCommand)GetBytes()[]byte {
+	buffer := make([]byte, c.Length())
+	c.WriteBytes(buffer)
+	return buffer
+}
+
+func(c *BuildVersionCommand)Length() int {
+	return BuildVersionCommandSize + len(c.Tools)*8
+}
+
+func(c *BuildVersionCommand)Type() int {
+	return LC_BuildVersion
+}
+
+// LC_SOURCE_VERSION，版本号为 A.B.C.D.E 格式(a24.b10.c10.d10.e10)
+const SourceVersionCommandSize = 16
+type SourceVersionCommand struct {
+	Version uint64
+}
+
+func(c *SourceVersionCommand)Load(buffer []byte) int {
+	c.Version = binary.LittleEndian.Uint64(buffer[8:])
+	return SourceVersionCommandSize
+}
+
+func(c *SourceVersionCommand)WriteBytes(buffer []byte) int {
+	binary.LittleEndian.PutUint32(buffer, LC_SourceVersion)
+	binary.LittleEndian.PutUint32(buffer[4:], SourceVersionCommandSize)
+	binary.LittleEndian.PutUint64(buffer[8:], c.Version)
+	return SourceVersionCommandSize
+}
+
+func(c *SourceVersionCommand)GetBytes()[]byte {
+	buffer := make([]byte, SourceVersionCommandSize)
+	c.WriteBytes(buffer)
+	return buffer
+}
+
+func(c *SourceVersionCommand)Length() int {
+	return SourceVersionCommandSize
+}
+
+func(c *SourceVersionCommand)Type() int {
+	return LC_SourceVersion
+}
+
+// LC_MAIN
+const EntryPointCommandSize = 24
+type EntryPointCommand struct {
+	EntryOffset uint64 // main()相对__TEXT的文件偏移
+	StackSize   uint64
+}
+
+func(c *EntryPointCommand)Load(buffer []byte) int {
+	c.EntryOffset = binary.LittleEndian.Uint64(buffer[8:])
+	c.StackSize = binary.LittleEndian.Uint64(buffer[16:])
+	return EntryPointCommandSize
+}
+
+func(c *EntryPointCommand)WriteBytes(buffer []byte) int {
+	binary.LittleEndian.PutUint32(buffer, LC_MainEntryPoint)
+	binary.LittleEndian.PutUint32(buffer[4:], EntryPointCommandSize)
+	binary.LittleEndian.PutUint64(buffer[8:], c.EntryOffset)
+	binary.LittleEndian.PutUint64(buffer[16:], c.StackSize)
+	return EntryPointCommandSize
+}
+
+func(c *EntryPointCommand)GetBytes()[]byte {
+	buffer := make([]byte, EntryPointCommandSize)
+	c.WriteBytes(buffer)
+	return buffer
+}
+
+func(c *EntryPointCommand)Length() int {
+	return EntryPointCommandSize
+}
+
+func(c *EntryPointCommand)Type() int {
+	return LC_MainEntryPoint
+}
+
+// LC_DYLD_INFO、LC_DYLD_INFO_ONLY
+const DyldInfoCommandSize = 48
+type DyldInfoCommand struct {
+	commandType  uint32
+	RebaseOffset uint32
+	RebaseSize   uint32
+	BindOffset   uint32
+	BindSize     uint32
+	WeakBindOffset uint32
+	WeakBindSize   uint32
+	LazyBindOffset uint32
+	LazyBindSize   uint32
+	ExportOffset uint32
+	ExportSize   uint32
+}
+
+func(c *DyldInfoCommand)Load(buffer []byte) int {
+	c.commandType = binary.LittleEndian.Uint32(buffer)
+	c.RebaseOffset = binary.LittleEndian.Uint32(buffer[8:])
+	c.RebaseSize = binary.LittleEndian.Uint32(buffer[12:])
+	c.BindOffset = binary.LittleEndian.Uint32(buffer[16:])
+	c.BindSize = binary.LittleEndian.Uint32(buffer[20:])
+	c.WeakBindOffset = binary.LittleEndian.Uint32(buffer[24:])
+	c.WeakBindSize = binary.LittleEndian.Uint32(buffer[28:])
+	c.LazyBindOffset = binary.LittleEndian.Uint32(buffer[32:])
+	c.LazyBindSize = binary.LittleEndian.Uint32(buffer[36:])
+	c.ExportOffset = binary.LittleEndian.Uint32(buffer[40:])
+	c.ExportSize = binary.LittleEndian.Uint32(buffer[44:])
+	return DyldInfoCommandSize
+}
+
+func(c *DyldInfoCommand)WriteBytes(buffer []byte) int {
+	binary.LittleEndian.PutUint32(buffer, c.commandType)
+	binary.LittleEndian.PutUint32(buffer[4:], DyldInfoCommandSize)
+	binary.LittleEndian.PutUint32(buffer[8:], c.RebaseOffset)
+	binary.LittleEndian.PutUint32(buffer[12:], c.RebaseSize)
+	binary.LittleEndian.PutUint32(buffer[16:], c.BindOffset)
+	binary.LittleEndian.PutUint32(buffer[20:], c.BindSize)
+	binary.LittleEndian.PutUint32(buffer[24:], c.WeakBindOffset)
+	binary.LittleEndian.PutUint32(buffer[28:], c.WeakBindSize)
+	binary.LittleEndian.PutUint32(buffer[32:], c.LazyBindOffset)
+	binary.LittleEndian.PutUint32(buffer[36:], c.LazyBindSize)
+	binary.LittleEndian.PutUint32(buffer[40:], c.ExportOffset)
+	binary.LittleEndian.PutUint32(buffer[44:], c.ExportSize)
+	return DyldInfoCommandSize
+}
+
+func(c *DyldInfoCommand)GetBytes()[]byte {
+	buffer := make([]byte, DyldInfoCommandSize)
+	c.WriteBytes(buffer)
+	return buffer
+}
+
+func(c *DyldInfoCommand)Length() int {
+	return DyldInfoCommandSize
+}
+
+func(c *DyldInfoCommand)Type() int {
+	return int(c.commandType)
+}
+
+// LC_SYMTAB
+const SymtabCommandSize = 24
+type SymtabCommand struct {
+	SymbolOffset    uint32
+	NumberOfSymbols uint32
+	StringOffset    uint32
+	StringSize      uint32
+}
+
+func(c *SymtabCommand)Load(buffer []byte) int {
+	c.SymbolOffset = binary.LittleEndian.Uint32(buffer[8:])
+	c.NumberOfSymbols = binary.LittleEndian.Uint32(buffer[12:])
+	c.StringOffset = binary.LittleEndian.Uint32(buffer[16:])
+	c.StringSize = binary.LittleEndian.Uint32(buffer[20:])
+	return SymtabCommandSize
+}
+
+func(c *SymtabCommand)WriteBytes(buffer []byte) int {
+	binary.LittleEndian.PutUint32(buffer, LC_SymbolTable)
+	binary.LittleEndian.PutUint32(buffer[4:], SymtabCommandSize)
+	binary.LittleEndian.PutUint32(buffer[8:], c.SymbolOffset)
+	binary.LittleEndian.PutUint32(buffer[12:], c.NumberOfSymbols)
+	binary.LittleEndian.PutUint32(buffer[16:], c.StringOffset)
+	binary.LittleEndian.PutUint32(buffer[20:], c.StringSize)
+	return SymtabCommandSize
+}
+
+func(c *SymtabCommand)GetBytes()[]byte {
+	buffer := make([]byte, SymtabCommandSize)
+	c.WriteBytes(buffer)
+	return buffer
+}
+
+func(c *SymtabCommand)Length() int {
+	return SymtabCommandSize
+}
+
+func(c *SymtabCommand)Type() int {
+	return LC_SymbolTable
+}
+
+// LC_DYSYMTAB
+const DysymtabCommandSize = 80
+type DysymtabCommand struct {
+	LocalSymbolIndex          uint32 // ilocalsym
+	NumberOfLocalSymbols      uint32 // nlocalsym
+	ExternalSymbolIndex       uint32 // iextdefsym
+	NumberOfExternalSymbols   uint32 // nextdefsym
+	UndefinedSymbolIndex      uint32 // iundefsym
+	NumberOfUndefinedSymbols  uint32 // nundefsym
+	TocOffset                 uint32 // tocoff
+	NumberOfTocEntries        uint32 // ntoc
+	ModuleTableOffset         uint32 // modtaboff
+	NumberOfModules           uint32 // nmodtab
+	ExternalReferenceOffset   uint32 // extrefsymoff
+	NumberOfExternalReferences uint32 // nextrefsyms
+	IndirectSymbolOffset      uint32 // indirectsymoff
+	NumberOfIndirectSymbols   uint32 // nindirectsyms
+	ExternalRelocationOffset  uint32 // extreloff
+	NumberOfExternalRelocations uint32 // nextrel
+	LocalRelocationOffset     uint32 // locreloff
+	NumberOfLocalRelocations  uint32 // nlocrel
+}
+
+func(c *DysymtabCommand)fields()[]*uint32 {
+	return []*uint32{
+		&c.LocalSymbolIndex, &c.NumberOfLocalSymbols,
+		&c.ExternalSymbolIndex, &c.NumberOfExternalSymbols,
+		&c.UndefinedSymbolIndex, &c.NumberOfUndefinedSymbols,
+		&c.TocOffset, &c.NumberOfTocEntries,
+		&c.ModuleTableOffset, &c.NumberOfModules,
+		&c.ExternalReferenceOffset, &c.NumberOfExternalReferences,
+		&c.IndirectSymbolOffset, &c.NumberOfIndirectSymbols,
+		&c.ExternalRelocationOffset, &c.NumberOfExternalRelocations,
+		&c.LocalRelocationOffset, &c.NumberOfLocalRelocations,
+	}
+}
+
+func(c *DysymtabCommand)Load(buffer []byte) int {
+	for i, field := range c.fields() {
+		*field = binary.LittleEndian.Uint32(buffer[8+i*4:])
+	}
+	return DysymtabCommandSize
+}
+
+func(c *DysymtabCommand)WriteBytes(buffer []byte) int {
+	binary.LittleEndian.PutUint32(buffer, LC_DynamicSymbolTable)
+	binary.LittleEndian.PutUint32(buffer[4:], DysymtabCommandSize)
+	for i, field := range c.fields() {
+		binary.LittleEndian.PutUint32(buffer[8+i*4:], *field)
+	}
+	return DysymtabCommandSize
+}
+
+func(c *DysymtabCommand)GetBytes()[]byte {
+	buffer := make([]byte, DysymtabCommandSize)
+	c.WriteBytes(buffer)
+	return buffer
+}
+
+func(c *DysymtabCommand)Length() int {
+	return DysymtabCommandSize
+}
+
+func(c *DysymtabCommand)Type() int {
+	return LC_DynamicSymbolTable
+}
+
+// __LINKEDIT中的数据：LC_FUNCTION_STARTS、LC_DATA_IN_CODE、LC_SEGMENT_SPLIT_INFO、
+// LC_DYLIB_CODE_SIGN_DRS、LC_LINKER_OPTIMIZATION_HINT、LC_DYLD_EXPORTS_TRIE、LC_DYLD_CHAINED_FIXUPS
+// LC_CODE_SIGNATURE使用CodeSignatureCommand
+const LinkEditDataCommandSize = 16
+type LinkEditDataCommand struct {
+	commandType uint32
+	DataOffset  uint32
+	DataSize    uint32
+}
+
+func(c *LinkEditDataCommand)Load(buffer []byte) int {
+	c.commandType = binary.LittleEndian.Uint32(buffer)
+	c.DataOffset = binary.LittleEndian.Uint32(buffer[8:])
+	c.DataSize = binary.LittleEndian.Uint32(buffer[12:])
+	return LinkEditDataCommandSize
+}
+
+func(c *LinkEditDataCommand)WriteBytes(buffer []byte) int {
+	binary.LittleEndian.PutUint32(buffer, c.commandType)
+	binary.LittleEndian.PutUint32(buffer[4:], LinkEditDataCommandSize)
+	binary.LittleEndian.PutUint32(buffer[8:], c.DataOffset)
+	binary.LittleEndian.PutUint32(buffer[12:], c.DataSize)
+	return LinkEditDataCommandSize
+}
+
+func(c *LinkEditDataCommand)GetBytes()[]byte {
+	buffer := make([]byte, LinkEditDataCommandSize)
+	c.WriteBytes(buffer)
+	return buffer
+}
+
+func(c *LinkEditDataCommand)Length() int {
+	return LinkEditDataCommandSize
+}
+
+func(c *LinkEditDataCommand)Type() int {
+	return int(c.commandType)
+}
@@ -0,0 +1,123 @@
+package mach
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 按小端写入cmd、cmdsize和fields(字符串原样写入)，之后填充0到size字节
+func testCommandBytes(commandType uint32, size int, fields ...interface{})[]byte {
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, [2]uint32{commandType, uint32(size)})
+	for _, field := range fields {
+		if s, ok := field.(string); ok {
+			buffer.WriteString(s)
+		} else {
+			binary.Write(&buffer, binary.LittleEndian, field)
+		}
+	}
+	data := make([]byte, size)
+	copy(data, buffer.Bytes())
+	return data
+}
+
+func testName16(name string)[16]byte {
+	var b [16]byte
+	copy(b[:], name)
+	return b
+}
+
+func TestReadCommandRoundTrip(t *testing.T) {
+	text := testName16("__TEXT")
+	section := Section64{SectionName: testName16("__text"), SegmentName: text, Address: 0x100004000, Size: 0x200,
+		Offset: 0x4000, Align: 2, Flags: 0x80000400}
+	tests := []struct {
+		name    string
+		data    []byte
+		command Entity
+	}{
+		{"segment", testCommandBytes(LC_Segment64, SegmentCommand64Size+Section64Size, text,
+			[4]uint64{0x100000000, 0x8000, 0, 0x8000}, [4]uint32{5, 5, 1, 0}, section), new(SegmentCommand64)},
+		{"load dylib", testCommandBytes(LC_LoadDynamicLibrary, 56, [4]uint32{24, 2, 0x05000000, 0x10000},
+			"/usr/lib/libSystem.B.dylib"), new(DylibCommand)},
+		{"weak dylib", testCommandBytes(LC_LoadWeakDynamicLibrary, 64, [4]uint32{24, 2, 0x10000, 0x10000},
+			"@rpath/Weak.framework/Weak"), new(DylibCommand)},
+		{"id dylib", testCommandBytes(LC_IDDynamicLibrary, 48, [4]uint32{24, 1, 0x10203, 0x10000},
+			"@rpath/libfoo.dylib"), new(DylibCommand)},
+		{"dylinker", testCommandBytes(LC_LoadDynamicLinker, 32, uint32(12), "/usr/lib/dyld"), new(DylinkerCommand)},
+		{"rpath", testCommandBytes(LC_RunPath, 48, uint32(12), "@executable_path/Frameworks"), new(RunPathCommand)},
+		{"uuid", testCommandBytes(LC_UUID, UUIDCommandSize, [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}),
+			new(UUIDCommand)},
+		{"encryption info", testCommandBytes(LC_EncryptionInfo, EncryptionInfoCommandSize, [3]uint32{0x4000, 0x8000, 1}),
+			new(EncryptionInfoCommand)},
+		{"encryption info 64", testCommandBytes(LC_EncryptionInfo64, EncryptionInfoCommand64Size, [4]uint32{0x4000, 0x8000, 0, 0}),
+			new(EncryptionInfoCommand)},
+		{"build version", testCommandBytes(LC_BuildVersion, BuildVersionCommandSize+16,
+			[4]uint32{PlatformIOS, 0xc0000, 0xf0500, 2}, [4]uint32{3, 0x3070000, 4, 0x2610000}), new(BuildVersionCommand)},
+		{"version min", testCommandBytes(LC_VersionMinIPhoneOS, VersionMinCommandSize, [2]uint32{0x90000, 0xd0000}),
+			new(VersionMinCommand)},
+		{"source version", testCommandBytes(LC_SourceVersion, SourceVersionCommandSize, uint64(0x123400000400)),
+			new(SourceVersionCommand)},
+		{"main", testCommandBytes(LC_MainEntryPoint, EntryPointCommandSize, [2]uint64{0x4abc, 0}), new(EntryPointCommand)},
+		{"dyld info", testCommandBytes(LC_DynamicLinkerInfoOnly, DyldInfoCommandSize,
+			[10]uint32{0xc000, 0x10, 0xc010, 0x80, 0, 0, 0xc090, 0x40, 0xc0d0, 0x30}), new(DyldInfoCommand)},
+		{"symtab", testCommandBytes(LC_SymbolTable, SymtabCommandSize, [4]uint32{0xc100, 12, 0xc200, 0x100}),
+			new(SymtabCommand)},
+		{"dysymtab", testCommandBytes(LC_DynamicSymbolTable, DysymtabCommandSize,
+			[18]uint32{0, 2, 2, 5, 7, 5, 0, 0, 0, 0, 0, 0, 0xc300, 9}), new(DysymtabCommand)},
+		{"function starts", testCommandBytes(LC_FunctionStarts, LinkEditDataCommandSize, [2]uint32{0xc400, 8}),
+			new(LinkEditDataCommand)},
+		{"chained fixups", testCommandBytes(LC_DynamicLinkerChainedFixups, LinkEditDataCommandSize, [2]uint32{0xc408, 0x60}),
+			new(LinkEditDataCommand)},
+		{"code signature", testCommandBytes(LC_CodeSignature, CodeSignatureCommandSize, [2]uint32{0xd000, 0x1000}),
+			new(CodeSignatureCommand)},
+	}
+	for _, test := range tests {
+		command, err := ReadCommand(test.data)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if reflect.TypeOf(command) != reflect.TypeOf(test.command) {
+			t.Errorf("%s: read as %T, expected %T", test.name, command, test.command)
+			continue
+		}
+		if command.Length() != len(test.data) {
+			t.Errorf("%s: length %d, expected %d", test.name, command.Length(), len(test.data))
+		}
+		data := command.(interface{ GetBytes()[]byte }).GetBytes()
+		if !bytes.Equal(data, test.data) {
+			t.Errorf("%s: round trip\n got %x\nwant %x", test.name, data, test.data)
+		}
+	}
+}
+
+func TestDylibCommandNameGrows(t *testing.T) {
+	name := "/usr/lib/libz.1.dylib"
+	long := "@rpath/" + strings.Repeat("Long", 16) + ".framework/Long"
+	// 名称刚好填满命令时没有结尾的0，名称更长时会被截断
+	for _, size := range []uint32{uint32(DylibCommandSize + len(long)), DylibCommandSize + 8} {
+		command := NewDylibCommand(LC_LoadDynamicLibrary, name, 0x10000, 0x10000, true)
+		command.CommandSize = size
+		command.Name = long
+		if command.Length()%8 != 0 || command.Length() < DylibCommandSize+len(long)+1 {
+			t.Errorf("cmdsize %d: length %d does not hold the name", size, command.Length())
+		}
+		read, err := ReadCommand(command.GetBytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		dylib, ok := read.(*DylibCommand)
+		if !ok || dylib.Name != long || dylib.Length() != command.Length() {
+			t.Errorf("cmdsize %d: name did not round-trip: %#v", size, read)
+		}
+	}
+
+	rpath := &RunPathCommand{CommandSize: RunPathCommandSize, Path: long}
+	if read, err := ReadCommand(rpath.GetBytes()); err != nil || read.(*RunPathCommand).Path != long {
+		t.Errorf("rpath did not round-trip: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package mach
+
+import (
+	"errors"
+)
+
+// 依赖的动态库：LC_LOAD_DYLIB、LC_LOAD_WEAK_DYLIB、LC_REEXPORT_DYLIB、LC_LAZY_LOAD_DYLIB、LC_LOAD_UPWARD_DYLIB
+func(m *MachObjectFile)Dylibs()[]*DylibCommand {
+	var dylibs []*DylibCommand
+	for _, command := range m.LoadCommands {
+		if dylib, ok := command.(*DylibCommand); ok && dylib.Type() != LC_IDDynamicLibrary {
+			dylibs = append(dylibs, dylib)
+		}
+	}
+	return dylibs
+}
+
+// 动态库自身的install name(LC_ID_DYLIB)，不是动态库时返回空
+func(m *MachObjectFile)DylibID()string {
+	if dylib, ok := m.GetLoadCommand(LC_IDDynamicLibrary).(*DylibCommand); ok {
+		return dylib.Name
+	}
+	return ""
+}
+
+// 添加LC_LOAD_DYLIB或LC_LOAD_WEAK_DYLIB，如 @executable_path/Frameworks/libfoo.dylib
+func(m *MachObjectFile)AddDylib(path string, weak bool)error {
+	commandType := uint32(LC_LoadDynamicLibrary)
+	if weak {
+		commandType = LC_LoadWeakDynamicLibrary
+	}
+	for _, command := range m.LoadCommands {
+		if dylib, ok := command.(*DylibCommand); ok && dylib.Name == path && dylib.Type() != LC_IDDynamicLibrary {
+			return errors.New("dylib is already loaded: " + path)
+		}
+	}
+	return m.AddLoadCommand(NewDylibCommand(commandType, path, 0, 0, m.Header.Is64BitHeader))
+}
+
+// 修改依赖的动态库路径，同 install_name_tool -change
+// 先生成所有替换后的命令，header空间不足时不做任何修改
+func(m *MachObjectFile)ChangeDylib(oldPath, newPath string)error {
+	var indexes []int
+	var commands []Entity
+	for i, command := range m.LoadCommands {
+		dylib, ok := command.(*DylibCommand)
+		if !ok || dylib.Type() == LC_IDDynamicLibrary || dylib.Name != oldPath {
+			continue
+		}
+		newDylib := NewDylibCommand(dylib.commandType, newPath, dylib.CurrentVersion, dylib.CompatibilityVersion, m.Header.Is64BitHeader)
+		newDylib.Timestamp = dylib.Timestamp
+		indexes = append(indexes, i)
+		commands = append(commands, newDylib)
+	}
+	if len(indexes) == 0 {
+		return errors.New("dylib is not loaded: " + oldPath)
+	}
+	return m.ReplaceLoadCommands(indexes, commands)
+}
+
+// 修改动态库的LC_ID_DYLIB，同 install_name_tool -id
+func(m *MachObjectFile)SetDylibID(name string)error {
+	for i, command := range m.LoadCommands {
+		if dylib, ok := command.(*DylibCommand); ok && dylib.Type() == LC_IDDynamicLibrary {
+			newDylib := NewDylibCommand(LC_IDDynamicLibrary, name, dylib.CurrentVersion, dylib.CompatibilityVersion, m.Header.Is64BitHeader)
+			newDylib.Timestamp = dylib.Timestamp
+			return m.ReplaceLoadCommand(i, newDylib)
+		}
+	}
+	return errors.New("not a dynamic library: LC_ID_DYLIB was not found")
+}
+
+// 所有LC_RPATH
+func(m *MachObjectFile)RunPaths()[]string {
+	var paths []string
+	for _, command := range m.LoadCommands {
+		if rpath, ok := command.(*RunPathCommand); ok {
+			paths = append(paths, rpath.Path)
+		}
+	}
+	return paths
+}
+
+// 添加LC_RPATH，同 install_name_tool -add_rpath
+func(m *MachObjectFile)AddRunPath(path string)error {
+	for _, p := range m.RunPaths() {
+		if p == path {
+			return errors.New("rpath already exists: " + path)
+		}
+	}
+	return m.AddLoadCommand(NewRunPathCommand(path, m.Header.Is64BitHeader))
+}
+
+// 删除LC_RPATH，同 install_name_tool -delete_rpath
+func(m *MachObjectFile)DeleteRunPath(path string)error {
+	for i, command := range m.LoadCommands {
+		if rpath, ok := command.(*RunPathCommand); ok && rpath.Path == path {
+			m.RemoveLoadCommand(i)
+			return nil
+		}
+	}
+	return errors.New("rpath does not exist: " + path)
+}
@@ -0,0 +1,175 @@
+package mach
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// armv7和arm64两个架构的universal文件，重新读取后返回
+func testUniversalMachObjects(t *testing.T, fileType uint32)[]*MachObjectFile {
+	armv7 := testMachObject(false, CpuTypeArm)
+	armv7.Header.CpuSubType = 9
+	armv7.FatArch = &FatArch{CpuType: CpuTypeArm, CpuSubType: 9, Align: 1 << 14}
+	arm64 := testMachObject(true, CpuTypeArm64)
+	arm64.FatArch = &FatArch{CpuType: CpuTypeArm64, Align: 1 << 14}
+	for _, file := range []*MachObjectFile{armv7, arm64} {
+		file.Header.FileType = fileType
+		if fileType == FileTypeDynamicLibrary {
+			id := NewDylibCommand(LC_IDDynamicLibrary, "@rpath/libfoo.dylib", 0x10203, 0x10000, file.Header.Is64BitHeader)
+			if err := file.AddLoadCommand(id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	files, err := ReadMachObjects(PackMachObjects([]*MachObjectFile{armv7, arm64}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+type testDylib struct {
+	commandType uint32
+	name        string
+}
+
+func testDylibs(file *MachObjectFile)[]testDylib {
+	var dylibs []testDylib
+	for _, dylib := range file.Dylibs() {
+		dylibs = append(dylibs, testDylib{uint32(dylib.Type()), dylib.Name})
+	}
+	return dylibs
+}
+
+func TestEditMachObjectsDylibs(t *testing.T) {
+	files := testUniversalMachObjects(t, FileTypeExecutable)
+	var sections [][]byte
+	for _, file := range files {
+		sections = append(sections, file.GetBytes()[0x300:])
+	}
+	long := "@executable_path/Frameworks/" + strings.Repeat("Long", 8) + ".framework/Long"
+	err := EditMachObjects(files, func(file *MachObjectFile)error {
+		if err := file.ChangeDylib("/usr/lib/libSystem.B.dylib", long); err != nil {
+			return err
+		}
+		if err := file.AddDylib("@rpath/libweak.dylib", true); err != nil {
+			return err
+		}
+		if err := file.AddRunPath("@loader_path/Frameworks"); err != nil {
+			return err
+		}
+		return file.DeleteRunPath("@executable_path/Frameworks")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := PackMachObjects(files)
+	read, err := ReadMachObjects(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 {
+		t.Fatalf("expected 2 slices, found %d", len(read))
+	}
+	want := []testDylib{{LC_LoadDynamicLibrary, long}, {LC_LoadWeakDynamicLibrary, "@rpath/libweak.dylib"}}
+	for i, file := range read {
+		name := file.ArchitectureName()
+		dylibs := testDylibs(file)
+		if len(dylibs) != len(want) || dylibs[0] != want[0] || dylibs[1] != want[1] {
+			t.Errorf("%s: dylibs %v, expected %v", name, dylibs, want)
+		}
+		// 修改后的命令保留原有的版本
+		if dylib := file.Dylibs()[0]; dylib.CurrentVersion != 0x05000000 || dylib.CompatibilityVersion != 0x10000 {
+			t.Errorf("%s: dylib version 0x%x/0x%x changed", name, dylib.CurrentVersion, dylib.CompatibilityVersion)
+		}
+		if paths := file.RunPaths(); len(paths) != 1 || paths[0] != "@loader_path/Frameworks" {
+			t.Errorf("%s: rpaths %v", name, paths)
+		}
+		if int(file.Header.NumberOfLoadCommands) != len(file.LoadCommands) {
+			t.Errorf("%s: ncmds %d, found %d commands", name, file.Header.NumberOfLoadCommands, len(file.LoadCommands))
+		}
+		// 只使用header的空闲空间，section的数据位置不变
+		if !bytes.Equal(file.GetBytes()[0x300:], sections[i]) {
+			t.Errorf("%s: section data moved", name)
+		}
+	}
+
+	for _, test := range []struct {
+		name string
+		edit func(file *MachObjectFile)error
+	}{
+		{"change missing dylib", func(file *MachObjectFile)error { return file.ChangeDylib("/usr/lib/libz.dylib", "@rpath/libz.dylib") }},
+		{"add loaded dylib", func(file *MachObjectFile)error { return file.AddDylib("@rpath/libweak.dylib", false) }},
+		{"add existing rpath", func(file *MachObjectFile)error { return file.AddRunPath("@loader_path/Frameworks") }},
+		{"delete missing rpath", func(file *MachObjectFile)error { return file.DeleteRunPath("@executable_path/Frameworks") }},
+		{"set id of executable", func(file *MachObjectFile)error { return file.SetDylibID("@rpath/libbar.dylib") }},
+	} {
+		if err := EditMachObjects(read, test.edit); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+	if !bytes.Equal(PackMachObjects(read), data) {
+		t.Errorf("failed edits changed the file")
+	}
+}
+
+func TestEditMachObjectsDylibID(t *testing.T) {
+	files := testUniversalMachObjects(t, FileTypeDynamicLibrary)
+	if err := EditMachObjects(files, func(file *MachObjectFile)error {
+		return file.SetDylibID("@rpath/Foo.framework/Foo")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadMachObjects(PackMachObjects(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range read {
+		if id := file.DylibID(); id != "@rpath/Foo.framework/Foo" {
+			t.Errorf("%s: id %q", file.ArchitectureName(), id)
+		}
+		id := file.GetLoadCommand(LC_IDDynamicLibrary).(*DylibCommand)
+		if id.CurrentVersion != 0x10203 || id.CompatibilityVersion != 0x10000 {
+			t.Errorf("%s: id version 0x%x/0x%x changed", file.ArchitectureName(), id.CurrentVersion, id.CompatibilityVersion)
+		}
+		// LC_ID_DYLIB不是依赖的动态库
+		if dylibs := testDylibs(file); len(dylibs) != 1 || dylibs[0].name != "/usr/lib/libSystem.B.dylib" {
+			t.Errorf("%s: dylibs %v", file.ArchitectureName(), dylibs)
+		}
+	}
+}
+
+func TestEditMachObjectsNotEnoughPadding(t *testing.T) {
+	files := testUniversalMachObjects(t, FileTypeExecutable)
+	// 只填满arm64的header空闲空间
+	arm64 := files[1]
+	for i := 0; arm64.HeaderPadding() >= 0x40; i++ {
+		if err := arm64.AddRunPath(fmt.Sprintf("@loader_path/%02d/%s", i, strings.Repeat("x", 32))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := PackMachObjects(files)
+	path := "@executable_path/" + strings.Repeat("Frameworks/", 10)
+	if files[0].HeaderPadding() < len(path)+RunPathCommandSize+8 {
+		t.Fatalf("armv7 padding %d is too small for the test", files[0].HeaderPadding())
+	}
+
+	edits := map[string]func(file *MachObjectFile)error{
+		"add rpath":    func(file *MachObjectFile)error { return file.AddRunPath(path) },
+		"add dylib":    func(file *MachObjectFile)error { return file.AddDylib(path+"libfoo.dylib", false) },
+		"change dylib": func(file *MachObjectFile)error { return file.ChangeDylib("/usr/lib/libSystem.B.dylib", path+"libSystem.dylib") },
+	}
+	for name, edit := range edits {
+		err := EditMachObjects(files, edit)
+		if err == nil || !strings.HasPrefix(err.Error(), "arm64: ") {
+			t.Errorf("%s: expected an arm64 error, got %v", name, err)
+		}
+		// armv7已经修改成功，但是所有架构都不变
+		if !bytes.Equal(PackMachObjects(files), data) {
+			t.Errorf("%s: failed edit changed the file", name)
+		}
+	}
+}
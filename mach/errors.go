@@ -0,0 +1,36 @@
+package mach
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 解析错误的类型，可以用errors.Is判断
+var (
+	ErrNotMachObject        = errors.New("not a Mach-O file")
+	ErrBigEndianMachObject  = errors.New("big-endian Mach-O files are not supported")
+	ErrTruncatedHeader      = errors.New("truncated header")
+	ErrBadCommandSize       = errors.New("bad load command size")
+	ErrOverlappingSlices    = errors.New("overlapping slices")
+	ErrOffsetBeyondFile     = errors.New("offset beyond end of file")
+	ErrBadAlignment         = errors.New("bad alignment")
+)
+
+// 带有位置信息的解析错误
+type FormatError struct {
+	Offset int    // 出错的数据在文件中的偏移
+	Detail string // 具体的字段，如 load command 3
+	Err    error  // 上面的错误类型之一
+}
+
+func(e *FormatError)Error()string {
+	return fmt.Sprintf("mach: %s at offset 0x%x: %v", e.Detail, e.Offset, e.Err)
+}
+
+func(e *FormatError)Unwrap()error {
+	return e.Err
+}
+
+func formatError(err error, offset int, format string, args ...interface{})error {
+	return &FormatError{Offset: offset, Detail: fmt.Sprintf(format, args...), Err: err}
+}
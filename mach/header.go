@@ -105,6 +105,20 @@ const(
 	LC_LoadWeakDynamicLibrary = 0x80000018 // LC_LOAD_WEAK_DYLIB
 	LC_DynamicLinkerInfoOnly = 0x80000022  // LC_DYLD_INFO_ONLY
 	LC_MainEntryPoint = 0x80000028         // LC_MAIN
+	LC_SegmentSplitInfo = 0x0000001E       // LC_SEGMENT_SPLIT_INFO
+	LC_LazyLoadDynamicLibrary = 0x00000020 // LC_LAZY_LOAD_DYLIB
+	LC_DynamicLinkerInfo = 0x00000022      // LC_DYLD_INFO
+	LC_VersionMinMacOSX = 0x00000024       // LC_VERSION_MIN_MACOSX
+	LC_DylibCodeSignDRs = 0x0000002B       // LC_DYLIB_CODE_SIGN_DRS
+	LC_LinkerOptimizationHint = 0x0000002E // LC_LINKER_OPTIMIZATION_HINT
+	LC_VersionMinTvOS = 0x0000002F         // LC_VERSION_MIN_TVOS
+	LC_VersionMinWatchOS = 0x00000030      // LC_VERSION_MIN_WATCHOS
+	LC_BuildVersion = 0x00000032           // LC_BUILD_VERSION
+	LC_RunPath = 0x8000001C                // LC_RPATH
+	LC_ReexportDynamicLibrary = 0x8000001F // LC_REEXPORT_DYLIB
+	LC_LoadUpwardDynamicLibrary = 0x80000023 // LC_LOAD_UPWARD_DYLIB
+	LC_DynamicLinkerExportsTrie = 0x80000033 // LC_DYLD_EXPORTS_TRIE
+	LC_DynamicLinkerChainedFixups = 0x80000034 // LC_DYLD_CHAINED_FIXUPS
 )
 
 type MachHeader struct {
@@ -118,14 +132,22 @@ type MachHeader struct {
 	Reserved             uint32  // 64-Bit only
 }
 
-func (h *MachHeader)Load(buffer []byte) int {
+func (h *MachHeader)Load(buffer []byte)(int, error) {
+	if len(buffer) < 4 {
+		return 0, formatError(ErrTruncatedHeader, 0, "mach header")
+	}
 	magic := binary.BigEndian.Uint32(buffer)
 	if magic == MachO64BitLittleEndianSignature {
 		h.Is64BitHeader = true
 	} else if magic == MachO32BitLittleEndianSignature {
 		h.Is64BitHeader = false
+	} else if IsBigEndianMachHeader(buffer) {
+		return 0, ErrBigEndianMachObject
 	} else {
-		return 0
+		return 0, ErrNotMachObject
+	}
+	if len(buffer) < h.Length() {
+		return 0, formatError(ErrTruncatedHeader, 0, "mach header")
 	}
 	h.CpuType = binary.LittleEndian.Uint32(buffer[4:])
 	h.CpuSubType = binary.LittleEndian.Uint32(buffer[8:])
@@ -135,9 +157,9 @@ func (h *MachHeader)Load(buffer []byte) int {
 	h.Flags = binary.LittleEndian.Uint32(buffer[24:])
 	if h.Is64BitHeader {
 		h.Reserved = binary.LittleEndian.Uint32(buffer[28:])
-		return Length64Bit
+		return Length64Bit, nil
 	}
-	return Length32Bit
+	return Length32Bit, nil
 }
 
 func(h *MachHeader) WriteBytes(buffer []byte) int{
@@ -171,25 +193,50 @@ func(h *MachHeader) Length()int {
 	return Length32Bit
 }
 
+// 大端的Mach-O(如PowerPC)，不支持解析
+func IsBigEndianMachHeader(buffer []byte) bool {
+	if len(buffer) < 4 {
+		return false
+	}
+	magic := binary.BigEndian.Uint32(buffer)
+	return magic == MachO32BitBigEndianSignature || magic == MachO64BitBigEndianSignature
+}
+
 func IsMachHeader(buffer []byte) bool {
+	if len(buffer) < 4 {
+		return false
+	}
 	magic := binary.BigEndian.Uint32(buffer)
 	return magic == MachO32BitLittleEndianSignature || magic == MachO64BitLittleEndianSignature
 }
 
 const FatHeaderSize = 8
-const FatSignature = 0xcafebabe
+const FatSignature = 0xcafebabe   // FAT_MAGIC
+const FatSignature64 = 0xcafebabf // FAT_MAGIC_64，架构表使用fat_arch_64
 type FatHeader struct {
 	//FatSignature          uint32
+	Is64Bit               bool
 	NumberOfArchitectures uint32
 }
 
-func (f *FatHeader)Load(buffer []byte) int {
+func (f *FatHeader)Load(buffer []byte)(int, error) {
+	if len(buffer) < FatHeaderSize {
+		return 0, formatError(ErrTruncatedHeader, 0, "fat header")
+	}
+	if !IsFatHeader(buffer) {
+		return 0, ErrNotMachObject
+	}
+	f.Is64Bit = binary.BigEndian.Uint32(buffer) == FatSignature64
 	f.NumberOfArchitectures = binary.BigEndian.Uint32(buffer[4:])
-	return FatHeaderSize
+	return FatHeaderSize, nil
 }
 
 func(f *FatHeader) WriteBytes(buffer []byte)[]byte {
-	binary.BigEndian.PutUint32(buffer, FatSignature)
+	if f.Is64Bit {
+		binary.BigEndian.PutUint32(buffer, FatSignature64)
+	} else {
+		binary.BigEndian.PutUint32(buffer, FatSignature)
+	}
 	binary.BigEndian.PutUint32(buffer[4:], f.NumberOfArchitectures)
 	return buffer
 }
@@ -204,8 +251,11 @@ func(f *FatHeader) Length()int {
 }
 
 func IsFatHeader(buffer []byte)bool {
+	if len(buffer) < 4 {
+		return false
+	}
 	magic := binary.BigEndian.Uint32(buffer)
-	return magic == FatSignature
+	return magic == FatSignature || magic == FatSignature64
 }
 
 func IsUniversalBinaryFile(buffer []byte)bool{
@@ -1,32 +1,50 @@
 package mach
 
-func ReadMachObjects(buffer []byte)[]*MachObjectFile {
+import (
+	"errors"
+)
+
+// 读取Mach-O文件，universal文件返回每个架构，架构的FatArch保留原有的信息
+func ReadMachObjects(buffer []byte)([]*MachObjectFile, error) {
 	if IsUniversalBinaryFile(buffer) {
 		file := new(UniversalBinaryFile)
-		file.Load(buffer)
-		return file.machObjects
-	} else if IsMachObjectFile(buffer) {
-		mach := new(MachObjectFile)
-		mach.Load(buffer)
-		return []*MachObjectFile{mach}
+		if err := file.Load(buffer); err != nil {
+			return nil, err
+		}
+		return file.machObjects, nil
 	}
-	return nil
+	mach := new(MachObjectFile)
+	if _, err := mach.Load(buffer); err != nil {
+		return nil, err
+	}
+	return []*MachObjectFile{mach}, nil
 }
 
+// 写入Mach-O文件，保持读取时的容器格式，多个架构时保留原有的对齐和顺序
+// 来自universal文件(FatArch不为nil)的架构写为universal文件，即使只有一个架构，FatArch.Is64Bit时为fat64
 func PackMachObjects(files []*MachObjectFile)[]byte {
-	if len(files) == 1 {
+	if len(files) == 1 && files[0].FatArch == nil {
 		return files[0].GetBytes()
 	}
-	universalBinaryFile := new(UniversalBinaryFile)
-	universalBinaryFile.Header.NumberOfArchitectures = uint32(len(files))
-	for _, machObject := range files {
-		fatArch := new(FatArch)
-		fatArch.CpuType = machObject.Header.CpuType
-		fatArch.CpuSubType = machObject.Header.CpuSubType
-		fatArch.Align = DefaultAlignment
-		universalBinaryFile.fatArchs = append(universalBinaryFile.fatArchs, fatArch)
-		universalBinaryFile.machObjects = append(universalBinaryFile.machObjects, machObject)
-	}
-	return universalBinaryFile.GetBytes()
+	return NewUniversalBinaryFile(files).GetBytes()
 }
 
+// 对每个架构执行edit，如修改依赖的动态库和rpath
+// 在副本上修改，所有架构都成功后才更新files，任何一个架构失败时files不变
+func EditMachObjects(files []*MachObjectFile, edit func(file *MachObjectFile)error)error {
+	edited := make([]*MachObjectFile, len(files))
+	for i, file := range files {
+		clone := &MachObjectFile{FatArch: file.FatArch}
+		if _, err := clone.Load(file.GetBytes()); err != nil {
+			return err
+		}
+		if err := edit(clone); err != nil {
+			return errors.New(file.ArchitectureName() + ": " + err.Error())
+		}
+		edited[i] = clone
+	}
+	for i, file := range files {
+		*file = *edited[i]
+	}
+	return nil
+}
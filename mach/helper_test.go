@@ -0,0 +1,133 @@
+package mach
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 最小的可执行文件：__TEXT(含一个section)、__LINKEDIT和常见的load commands
+func testMachObject(is64Bit bool, cpuType uint32)*MachObjectFile {
+	var commands []Entity
+	var text, linkEdit Entity
+	if is64Bit {
+		segment := &SegmentCommand64{FileSize: 0x400, VMSize: 0x400, MaxProt: 5, InitProt: 5}
+		copy(segment.SegmentName[:], TextSegmentName)
+		section := &Section64{Size: 0x100, Offset: 0x300, Align: 2}
+		copy(section.SectionName[:], "__text")
+		copy(section.SegmentName[:], TextSegmentName)
+		segment.Sections = append(segment.Sections, section)
+		segment.CommandSize = uint32(segment.Length())
+		text = segment
+		segment = &SegmentCommand64{FileOffset: 0x400, FileSize: 0x40, VMAddress: 0x400, VMSize: 0x400, MaxProt: 1, InitProt: 1}
+		copy(segment.SegmentName[:], LinkEditSegmentName)
+		segment.CommandSize = uint32(segment.Length())
+		linkEdit = segment
+	} else {
+		segment := &SegmentCommand32{FileSize: 0x400, VMSize: 0x400, MaxProt: 5, InitProt: 5}
+		copy(segment.SegmentName[:], TextSegmentName)
+		section := &Section32{Size: 0x100, Offset: 0x300, Align: 2}
+		copy(section.SectionName[:], "__text")
+		copy(section.SegmentName[:], TextSegmentName)
+		segment.Sections = append(segment.Sections, section)
+		segment.CommandSize = uint32(segment.Length())
+		text = segment
+		segment = &SegmentCommand32{FileOffset: 0x400, FileSize: 0x40, VMAddress: 0x400, VMSize: 0x400, MaxProt: 1, InitProt: 1}
+		copy(segment.SegmentName[:], LinkEditSegmentName)
+		segment.CommandSize = uint32(segment.Length())
+		linkEdit = segment
+	}
+	commands = append(commands, text, linkEdit,
+		NewDylibCommand(LC_LoadDynamicLibrary, "/usr/lib/libSystem.B.dylib", 0x05000000, 0x10000, is64Bit),
+		NewRunPathCommand("@executable_path/Frameworks", is64Bit),
+		&BuildVersionCommand{Platform: PlatformIOS, MinOS: 0xc0000, SDK: 0xe0000, Tools: []BuildToolVersion{{3, 0x2610000}}},
+		&EncryptionInfoCommand{Is64Bit: is64Bit, CryptOffset: 0x300, CryptSize: 0x100})
+	m := &MachObjectFile{
+		Header:       &MachHeader{Is64BitHeader: is64Bit, CpuType: cpuType, FileType: 2},
+		LoadCommands: commands,
+	}
+	for _, command := range commands {
+		m.Header.NumberOfLoadCommands++
+		m.Header.SizeOfLoadCommands += uint32(command.Length())
+	}
+	m.DataOffset = m.Header.Length() + int(m.Header.SizeOfLoadCommands)
+	m.Data = make([]byte, 0x440-m.DataOffset)
+	for i := 0x300 - m.DataOffset; i < len(m.Data); i++ {
+		m.Data[i] = byte(i)
+	}
+	return m
+}
+
+func FuzzReadMachObjects(f *testing.F) {
+	thin := testMachObject(true, CpuTypeArm64).GetBytes()
+	f.Add(thin)
+	f.Add(testMachObject(false, CpuTypeArm).GetBytes())
+	arm := testMachObject(false, CpuTypeArm)
+	arm.FatArch = &FatArch{CpuType: CpuTypeArm, Align: 1 << 4}
+	arm64 := testMachObject(true, CpuTypeArm64)
+	arm64.FatArch = &FatArch{CpuType: CpuTypeArm64, Align: 1 << 4}
+	f.Add(NewUniversalBinaryFile([]*MachObjectFile{arm, arm64}).GetBytes())
+	arm64.FatArch = &FatArch{Is64Bit: true, CpuType: CpuTypeArm64, Align: 1 << 4}
+	f.Add(NewUniversalBinaryFile([]*MachObjectFile{arm64}).GetBytes())
+	f.Add(thin[:40])
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		files, err := ReadMachObjects(data)
+		if err != nil {
+			return
+		}
+		for _, file := range files {
+			file.IsEncrypted()
+			file.Dylibs()
+			file.RunPaths()
+			file.HeaderPadding()
+			file.GetCodeSignatureBytes()
+		}
+		packed := PackMachObjects(files)
+		if !IsUniversalBinaryFile(data) && !bytes.Equal(packed, data) {
+			t.Fatalf("thin Mach-O did not round-trip")
+		}
+		if _, err := ReadMachObjects(packed); err != nil {
+			t.Fatalf("packed Mach-O cannot be read: %v", err)
+		}
+	})
+}
+
+func TestPackMachObjectsKeepsContainer(t *testing.T) {
+	fatArch := func(file *MachObjectFile, is64Bit bool, align uint32)*MachObjectFile {
+		file.FatArch = &FatArch{Is64Bit: is64Bit, CpuType: file.Header.CpuType, CpuSubType: file.Header.CpuSubType, Align: align}
+		return file
+	}
+	inputs := map[string][]byte{
+		"thin": testMachObject(true, CpuTypeArm64).GetBytes(),
+		"fat": NewUniversalBinaryFile([]*MachObjectFile{
+			fatArch(testMachObject(false, CpuTypeArm), false, 1 << 12),
+			fatArch(testMachObject(true, CpuTypeArm64), false, 1 << 14)}).GetBytes(),
+		"single fat": NewUniversalBinaryFile([]*MachObjectFile{fatArch(testMachObject(true, CpuTypeArm64), false, 1 << 14)}).GetBytes(),
+		"single fat64": NewUniversalBinaryFile([]*MachObjectFile{fatArch(testMachObject(true, CpuTypeArm64), true, 1 << 14)}).GetBytes(),
+	}
+	for name, data := range inputs {
+		files, err := ReadMachObjects(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(PackMachObjects(files), data) {
+			t.Errorf("%s: container changed on repack", name)
+		}
+	}
+
+	files, _ := ReadMachObjects(inputs["fat"])
+	thin, err := ExtractArchitecture(files, "arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packed := PackMachObjects([]*MachObjectFile{thin}); !IsMachObjectFile(packed) {
+		t.Errorf("extracted architecture is not a thin Mach-O")
+	}
+	merged, err := MergeMachObjects([]*MachObjectFile{thin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packed := PackMachObjects(merged); !IsUniversalBinaryFile(packed) {
+		t.Errorf("merged file is not a universal Mach-O")
+	}
+}
@@ -2,7 +2,8 @@ package mach
 
 import (
 	"encoding/binary"
-	"log"
+	"errors"
+	"fmt"
 	"math"
 )
 
@@ -18,27 +19,57 @@ type MachObjectFile struct {
 	LoadCommands []Entity
 	DataOffset   int
 	Data         []byte
+	FatArch      *FatArch // 在universal文件中的架构信息，单架构文件为nil
 }
 
-func(m *MachObjectFile)Load(buffer []byte)int {
+func(m *MachObjectFile)Load(buffer []byte)(int, error) {
 	m.Header = new(MachHeader)
-	offset := m.Header.Load(buffer)
-
+	offset, err := m.Header.Load(buffer)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(offset)+uint64(m.Header.SizeOfLoadCommands) > uint64(len(buffer)) {
+		return 0, formatError(ErrTruncatedHeader, offset, "load commands")
+	}
+	m.DataOffset = offset + int(m.Header.SizeOfLoadCommands)
+	m.LoadCommands = nil
 	for i := uint32(0); i < m.Header.NumberOfLoadCommands; i++ {
-		command := NewCommand(buffer[offset:])
-		commandLen := int(binary.LittleEndian.Uint32(buffer[offset+4:]))
-		commandLen2 := command.Load(buffer[offset : offset+commandLen])
-		if commandLen != commandLen2 {
-			panic("error exec file")
-			return 0
-		}
-		offset += commandLen
+		command, err := ReadCommand(buffer[offset:m.DataOffset])
+		if err != nil {
+			return 0, formatError(err, offset, "load command %d", i)
+		}
+		offset += command.Length()
 		m.LoadCommands = append(m.LoadCommands, command)
 	}
-	m.DataOffset = m.Header.Length() + int(m.Header.SizeOfLoadCommands)
-	dataLength := len(buffer) - m.DataOffset
-	m.Data = buffer[offset : offset+dataLength]
-	return offset + dataLength
+	if offset != m.DataOffset {
+		return 0, formatError(ErrBadCommandSize, offset, "load commands")
+	}
+	if err := m.checkFileOffsets(len(buffer)); err != nil {
+		return 0, err
+	}
+	m.Data = buffer[m.DataOffset:]
+	return len(buffer), nil
+}
+
+// segment和签名数据必须在文件范围内
+func(m *MachObjectFile)checkFileOffsets(fileSize int)error {
+	offset := m.Header.Length()
+	for i, command := range m.LoadCommands {
+		var start, size uint64
+		switch c := command.(type) {
+		case *SegmentCommand32:
+			start, size = uint64(c.FileOffset), uint64(c.FileSize)
+		case *SegmentCommand64:
+			start, size = c.FileOffset, c.FileSize
+		case *CodeSignatureCommand:
+			start, size = uint64(c.DataOffset), uint64(c.DataSize)
+		}
+		if start+size < start || start+size > uint64(fileSize) {
+			return formatError(ErrOffsetBeyondFile, offset, "load command %d", i)
+		}
+		offset += command.Length()
+	}
+	return nil
 }
 
 func(m *MachObjectFile) WriteBytes(buffer []byte)int {
@@ -79,36 +110,179 @@ func(m *MachObjectFile)GetLoadCommand(commandType int) Entity {
 
 func(m *MachObjectFile)GetCodeSignatureBytes()[]byte {
 	var sign []byte
-	command := m.GetLoadCommand(LC_CodeSignature).(*CodeSignatureCommand)
-	if command != nil {
+	command, ok := m.GetLoadCommand(LC_CodeSignature).(*CodeSignatureCommand)
+	if ok {
 		offset := int(command.DataOffset) - m.DataOffset
-		sign = m.Data[offset : offset+int(command.DataSize)]
+		end := offset + int(command.DataSize)
+		if offset >= 0 && end >= offset && end <= len(m.Data) {
+			sign = m.Data[offset:end]
+		}
 	}
 	return sign
 }
 
+// 是否有FairPlay加密(LC_ENCRYPTION_INFO的cryptid不为0)，加密的代码重签名后无法运行
+func(m *MachObjectFile)IsEncrypted()bool {
+	for _, command := range m.LoadCommands {
+		switch info := command.(type) {
+		case *EncryptionInfoCommand:
+			if info.CryptID != 0 {
+				return true
+			}
+		case *LoadCommand:
+			// 无法按类型解析的LC_ENCRYPTION_INFO(_64)，直接读取cryptid，长度不足时视为加密
+			if info.Type() == LC_EncryptionInfo || info.Type() == LC_EncryptionInfo64 {
+				if len(info.Data) < 12 || binary.LittleEndian.Uint32(info.Data[8:]) != 0 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// 编译使用的SDK版本(xxxx.yy.zz)，来自LC_BUILD_VERSION或LC_VERSION_MIN_*，没有时返回0
+func(m *MachObjectFile)SDKVersion()uint32 {
+	for _, command := range m.LoadCommands {
+		switch version := command.(type) {
+		case *BuildVersionCommand:
+			return version.SDK
+		case *VersionMinCommand:
+			return version.SDK
+		}
+	}
+	return 0
+}
+
+// load commands之后到第一个section之间的空闲字节数
+func(m *MachObjectFile)HeaderPadding()int {
+	first := len(m.Data) + m.DataOffset
+	for _, command := range m.LoadCommands {
+		switch segment := command.(type) {
+		case *SegmentCommand32:
+			for _, section := range segment.Sections {
+				if section.Offset != 0 && int(section.Offset) < first {
+					first = int(section.Offset)
+				}
+			}
+		case *SegmentCommand64:
+			for _, section := range segment.Sections {
+				if section.Offset != 0 && int(section.Offset) < first {
+					first = int(section.Offset)
+				}
+			}
+		}
+	}
+	if first < m.DataOffset {
+		return 0
+	}
+	return first - m.DataOffset
+}
+
+// 从load commands之后的空闲空间中取出size字节，空间不足或者不为0时返回错误
+func(m *MachObjectFile)reserveHeaderSpace(size int)error {
+	if size > m.HeaderPadding() {
+		return errors.New("not enough space in the Mach-O header to add a load command")
+	}
+	for _, b := range m.Data[:size] {
+		if b != 0 {
+			return errors.New("the space after the load commands is not empty")
+		}
+	}
+	m.Data = m.Data[size:]
+	return nil
+}
+
+// 添加一个load command，占用load commands之后的空闲空间，文件大小不变
+// 新的命令在LC_CODE_SIGNATURE之前
+func(m *MachObjectFile)AddLoadCommand(command Entity)error {
+	size := command.Length()
+	if err := m.reserveHeaderSpace(size); err != nil {
+		return err
+	}
+	n := len(m.LoadCommands)
+	if n > 0 && m.LoadCommands[n-1].Type() == LC_CodeSignature {
+		m.LoadCommands = append(m.LoadCommands[:n-1], command, m.LoadCommands[n-1])
+	} else {
+		m.LoadCommands = append(m.LoadCommands, command)
+	}
+	m.Header.NumberOfLoadCommands++
+	m.Header.SizeOfLoadCommands += uint32(size)
+	m.DataOffset += size
+	return nil
+}
+
+// 替换第index个load command，长度变化时移动load commands之后的空闲空间
+func(m *MachObjectFile)ReplaceLoadCommand(index int, command Entity)error {
+	return m.ReplaceLoadCommands([]int{index}, []Entity{command})
+}
+
+// 同时替换多个load command，空间不足时不做任何修改
+func(m *MachObjectFile)ReplaceLoadCommands(indexes []int, commands []Entity)error {
+	delta := 0
+	for i, index := range indexes {
+		delta += commands[i].Length() - m.LoadCommands[index].Length()
+	}
+	if delta > 0 {
+		if err := m.reserveHeaderSpace(delta); err != nil {
+			return err
+		}
+	} else if delta < 0 {
+		m.Data = append(make([]byte, -delta), m.Data...)
+	}
+	for i, index := range indexes {
+		m.LoadCommands[index] = commands[i]
+	}
+	m.Header.SizeOfLoadCommands = uint32(int(m.Header.SizeOfLoadCommands) + delta)
+	m.DataOffset += delta
+	return nil
+}
+
+// 删除第index个load command，释放的空间填充0
+func(m *MachObjectFile)RemoveLoadCommand(index int) {
+	size := m.LoadCommands[index].Length()
+	m.LoadCommands = append(m.LoadCommands[:index], m.LoadCommands[index+1:]...)
+	m.Header.NumberOfLoadCommands--
+	m.Header.SizeOfLoadCommands -= uint32(size)
+	m.Data = append(make([]byte, size), m.Data...)
+	m.DataOffset -= size
+}
+
 func IsMachObjectFile(buffer []byte)bool{
 	return IsMachHeader(buffer)
 }
 
 const FatArchSize = 20
+const FatArch64Size = 32
 type FatArch struct {
+	Is64Bit    bool // fat_arch_64
 	CpuType    uint32
 	CpuSubType uint32
-	Offset     uint32
-	Size       uint32
+	Offset     uint64
+	Size       uint64
 	Align      uint32
+	Reserved   uint32 // 64-Bit only
 }
 
 func(f *FatArch)Length() int{
+	if f.Is64Bit {
+		return FatArch64Size
+	}
 	return FatArchSize
 }
 
 func(f *FatArch)Load(buffer []byte) int{
 	f.CpuType = binary.BigEndian.Uint32(buffer)
 	f.CpuSubType = binary.BigEndian.Uint32(buffer[4:])
-	f.Offset = binary.BigEndian.Uint32(buffer[8:])
-	f.Size = binary.BigEndian.Uint32(buffer[12:])
+	if f.Is64Bit {
+		f.Offset = binary.BigEndian.Uint64(buffer[8:])
+		f.Size = binary.BigEndian.Uint64(buffer[16:])
+		f.Align = 1 << binary.BigEndian.Uint32(buffer[24:])
+		f.Reserved = binary.BigEndian.Uint32(buffer[28:])
+		return FatArch64Size
+	}
+	f.Offset = uint64(binary.BigEndian.Uint32(buffer[8:]))
+	f.Size = uint64(binary.BigEndian.Uint32(buffer[12:]))
 	f.Align = 1 << binary.BigEndian.Uint32(buffer[16:])
 	return FatArchSize
 }
@@ -116,87 +290,177 @@ func(f *FatArch)Load(buffer []byte) int{
 func(f *FatArch) WriteBytes(buffer []byte) int{
 	binary.BigEndian.PutUint32(buffer, f.CpuType)
 	binary.BigEndian.PutUint32(buffer[4:], f.CpuSubType)
-	binary.BigEndian.PutUint32(buffer[8:], f.Offset)
-	binary.BigEndian.PutUint32(buffer[12:], f.Size)
+	if f.Is64Bit {
+		binary.BigEndian.PutUint64(buffer[8:], f.Offset)
+		binary.BigEndian.PutUint64(buffer[16:], f.Size)
+		binary.BigEndian.PutUint32(buffer[24:], uint32(math.Log2(float64(f.Align))))
+		binary.BigEndian.PutUint32(buffer[28:], f.Reserved)
+		return FatArch64Size
+	}
+	binary.BigEndian.PutUint32(buffer[8:], uint32(f.Offset))
+	binary.BigEndian.PutUint32(buffer[12:], uint32(f.Size))
 	binary.BigEndian.PutUint32(buffer[16:], uint32(math.Log2(float64(f.Align))))
 	return FatArchSize
 }
 
 func(f *FatArch) GetBytes()[]byte {
-	buffer := make([]byte, FatArchSize)
+	buffer := make([]byte, f.Length())
 	f.WriteBytes(buffer)
 	return buffer
 }
 
 const DefaultAlignment = 16384
+const MaxAlignment = 1 << 15
 type UniversalBinaryFile struct {
 	Header        FatHeader
 	fatArchs      []*FatArch
 	machObjects   []*MachObjectFile
 }
 
+// 使用Mach-O原有的FatArch(对齐等)创建universal文件，没有时使用架构的默认对齐
+// 写入时只重新计算偏移和大小
+func NewUniversalBinaryFile(files []*MachObjectFile)*UniversalBinaryFile {
+	u := new(UniversalBinaryFile)
+	u.Header.NumberOfArchitectures = uint32(len(files))
+	for _, file := range files {
+		fatArch := &FatArch{
+			CpuType:    file.Header.CpuType,
+			CpuSubType: file.Header.CpuSubType,
+			Align:      ArchitectureAlignment(file.Header.CpuType),
+		}
+		if file.FatArch != nil {
+			*fatArch = *file.FatArch
+			u.Header.Is64Bit = u.Header.Is64Bit || file.FatArch.Is64Bit
+		}
+		u.fatArchs = append(u.fatArchs, fatArch)
+		u.machObjects = append(u.machObjects, file)
+	}
+	return u
+}
+
 func(u *UniversalBinaryFile)MachObjects()[]*MachObjectFile {
 	return u.machObjects
 }
 
-func(u *UniversalBinaryFile)Load(buffer []byte) {
-	offset := u.Header.Load(buffer)
+func(u *UniversalBinaryFile)FatArchs()[]*FatArch {
+	return u.fatArchs
+}
+
+func(u *UniversalBinaryFile)Load(buffer []byte)error {
+	offset, err := u.Header.Load(buffer)
+	if err != nil {
+		return err
+	}
 	count := int(u.Header.NumberOfArchitectures)
+	archSize := FatArchSize
+	if u.Header.Is64Bit {
+		archSize = FatArch64Size
+	}
+	if uint64(offset)+uint64(count)*uint64(archSize) > uint64(len(buffer)) {
+		return formatError(ErrTruncatedHeader, 0, "fat header")
+	}
 	machObjects := make([]*MachObjectFile, count)
 	fatArchs := make([]*FatArch, count)
 	for i := 0; i < count; i++ {
-		arch := new(FatArch)
-		offset += arch.Load(buffer[offset:])
+		arch := &FatArch{Is64Bit: u.Header.Is64Bit}
+		arch.Load(buffer[offset:])
+		if arch.Align == 0 || arch.Align > MaxAlignment {
+			return formatError(ErrBadAlignment, offset, "fat arch %d", i)
+		}
+		end := arch.Offset + arch.Size
+		if end < arch.Offset || end > uint64(len(buffer)) {
+			return formatError(ErrOffsetBeyondFile, offset, "fat arch %d", i)
+		}
+		if arch.Offset < uint64(FatHeaderSize+count*archSize) {
+			return formatError(ErrOverlappingSlices, offset, "fat arch %d", i)
+		}
+		for j := 0; j < i; j++ {
+			other := fatArchs[j]
+			if arch.Offset < other.Offset+other.Size && other.Offset < end {
+				return formatError(ErrOverlappingSlices, offset, "fat arch %d", i)
+			}
+		}
 		fatArchs[i] = arch
+		offset += archSize
 	}
 
 	for i := 0; i < count; i++ {
 		arch := fatArchs[i]
 		machObject := new(MachObjectFile)
-		machObject.Load(buffer[arch.Offset : arch.Offset+arch.Size])
+		if _, err := machObject.Load(buffer[arch.Offset : arch.Offset+arch.Size]); err != nil {
+			return fmt.Errorf("fat arch %d: %w", i, err)
+		}
+		machObject.FatArch = arch
 		machObjects[i] = machObject
 	}
 	u.fatArchs, u.machObjects = fatArchs, machObjects
-	log.Printf("UniversalBinaryFile:%v", count)
+	return nil
 }
 
-func(u *UniversalBinaryFile)Length( )int {
-	length := FatHeaderSize + len(u.fatArchs)*FatArchSize
-	for i := 0; i < len(u.fatArchs); i++ {
-		fatArch := u.fatArchs[i]
-		file := u.machObjects[i]
+// fat header和架构表的长度
+func fatHeaderLength(is64Bit bool, count int)int {
+	if is64Bit {
+		return FatHeaderSize + count*FatArch64Size
+	}
+	return FatHeaderSize + count*FatArchSize
+}
+
+// 每个架构按对齐在文件中的偏移，以及文件的总长度
+func fatArchOffsets(headerLength int, fatArchs []*FatArch, sizes []int)([]int, int) {
+	offsets := make([]int, len(fatArchs))
+	offset := headerLength
+	for i, fatArch := range fatArchs {
 		align := int(fatArch.Align)
 		if align == 0 {
 			align = DefaultAlignment
 		}
-		padding := (align - (length % align)) % align
-		length += padding
-		length += file.Length()
+		offset += (align - offset%align) % align
+		offsets[i] = offset
+		offset += sizes[i]
 	}
+	return offsets, offset
+}
+
+// fat_arch只能表示4GB以内的偏移和大小，超出时需要使用FAT_MAGIC_64
+func needsFatArch64(fatArchs []*FatArch, sizes []int)bool {
+	offsets, _ := fatArchOffsets(fatHeaderLength(false, len(fatArchs)), fatArchs, sizes)
+	for i, offset := range offsets {
+		if uint64(offset) > math.MaxUint32 || uint64(sizes[i]) > math.MaxUint32 {
+			return true
+		}
+	}
+	return false
+}
+
+// 写入的布局：是否使用FAT_MAGIC_64、每个架构的偏移、长度和文件的总长度
+func(u *UniversalBinaryFile)layout()(bool, []int, []int, int) {
+	sizes := make([]int, len(u.machObjects))
+	for i, file := range u.machObjects {
+		sizes[i] = file.Length()
+	}
+	is64Bit := u.Header.Is64Bit || needsFatArch64(u.fatArchs, sizes)
+	offsets, length := fatArchOffsets(fatHeaderLength(is64Bit, len(u.fatArchs)), u.fatArchs, sizes)
+	return is64Bit, offsets, sizes, length
+}
+
+func(u *UniversalBinaryFile)Length( )int {
+	_, _, _, length := u.layout()
 	return length
 }
 
+// 偏移或大小超过4GB时改为FAT_MAGIC_64
 func(u *UniversalBinaryFile) WriteBytes(buffer []byte) int {
+	is64Bit, offsets, sizes, length := u.layout()
+	u.Header.Is64Bit = is64Bit
 	u.Header.WriteBytes(buffer)
-	offset := FatHeaderSize + len(u.fatArchs)*FatArchSize
-	for i := 0; i < len(u.fatArchs); i++ {
-		fatArch := u.fatArchs[i]
-		file := u.machObjects[i]
-		fileLen := file.Length()
-		align := int(fatArch.Align)
-		if align == 0 {
-			align = DefaultAlignment
-		}
-		padding := (align - (offset % align)) % align
-		offset += padding
-		fatArch.Offset = uint32(offset)
-		fatArch.Size = uint32(fileLen)
-
-		fatArch.WriteBytes(buffer[FatHeaderSize+i*FatArchSize:])
-		file.WriteBytes(buffer[offset:])
-		offset += fileLen
+	for i, fatArch := range u.fatArchs {
+		fatArch.Is64Bit = is64Bit
+		fatArch.Offset = uint64(offsets[i])
+		fatArch.Size = uint64(sizes[i])
+		fatArch.WriteBytes(buffer[FatHeaderSize+i*fatArch.Length():])
+		u.machObjects[i].WriteBytes(buffer[offsets[i]:])
 	}
-	return offset
+	return length
 }
 
 func(u *UniversalBinaryFile)GetBytes( )[]byte {
@@ -0,0 +1,96 @@
+package mach
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestUniversalBinaryFat64(t *testing.T) {
+	arm := testMachObject(false, CpuTypeArm)
+	arm.FatArch = &FatArch{Is64Bit: true, CpuType: CpuTypeArm, CpuSubType: 9, Align: 1 << 12, Reserved: 7}
+	arm64 := testMachObject(true, CpuTypeArm64)
+	arm64.FatArch = &FatArch{Is64Bit: true, CpuType: CpuTypeArm64, Align: 1 << 14}
+	data := PackMachObjects([]*MachObjectFile{arm, arm64})
+	if binary.BigEndian.Uint32(data) != FatSignature64 {
+		t.Fatalf("magic 0x%x, expected FAT_MAGIC_64", binary.BigEndian.Uint32(data))
+	}
+	// fat_arch_64：cputype、cpusubtype、offset(64位)、size(64位)、align、reserved
+	entry := data[FatHeaderSize+FatArch64Size:]
+	if offset := binary.BigEndian.Uint64(entry[8:]); offset != 1<<14 {
+		t.Errorf("arm64 offset 0x%x, expected 0x4000", offset)
+	}
+	if size := binary.BigEndian.Uint64(entry[16:]); size != uint64(arm64.Length()) {
+		t.Errorf("arm64 size 0x%x, expected 0x%x", size, arm64.Length())
+	}
+	if align := binary.BigEndian.Uint32(entry[24:]); align != 14 {
+		t.Errorf("arm64 align 2^%d, expected 2^14", align)
+	}
+
+	files, err := ReadMachObjects(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 slices, found %d", len(files))
+	}
+	for i, want := range []*MachObjectFile{arm, arm64} {
+		file := files[i]
+		if !file.FatArch.Is64Bit || file.FatArch.Align != want.FatArch.Align || file.FatArch.CpuSubType != want.FatArch.CpuSubType ||
+			file.FatArch.Reserved != want.FatArch.Reserved {
+			t.Errorf("slice %d: fat arch %+v, expected %+v", i, *file.FatArch, *want.FatArch)
+		}
+		if file.FatArch.Offset%uint64(file.FatArch.Align) != 0 {
+			t.Errorf("slice %d: offset 0x%x is not aligned", i, file.FatArch.Offset)
+		}
+		if !bytes.Equal(file.GetBytes(), want.GetBytes()) {
+			t.Errorf("slice %d: content changed", i)
+		}
+	}
+	if !bytes.Equal(PackMachObjects(files), data) {
+		t.Errorf("fat64 file did not round-trip")
+	}
+}
+
+func TestNeedsFatArch64(t *testing.T) {
+	fatArchs := []*FatArch{{Align: 1 << 14}, {Align: 1 << 14}}
+	tests := []struct {
+		sizes []int
+		want  bool
+	}{
+		{[]int{0x1000, 0x1000}, false},
+		// 结束位置超过4GB，但偏移和大小都可以用32位表示
+		{[]int{0x1000, math.MaxUint32 - 0x8000}, false},
+		{[]int{0x1000, math.MaxUint32 + 1}, true},
+		// 第二个架构的偏移超过4GB
+		{[]int{math.MaxUint32, 0x1000}, true},
+	}
+	for _, test := range tests {
+		if got := needsFatArch64(fatArchs, test.sizes); got != test.want {
+			t.Errorf("sizes %#x: got %v, expected %v", test.sizes, got, test.want)
+		}
+	}
+}
+
+func TestReadBigEndianMachObject(t *testing.T) {
+	for _, magic := range []uint32{MachO32BitBigEndianSignature, MachO64BitBigEndianSignature} {
+		data := testMachObject(magic == MachO64BitBigEndianSignature, CpuTypePowerPC).GetBytes()
+		binary.BigEndian.PutUint32(data, magic)
+		if _, err := ReadMachObjects(data); !errors.Is(err, ErrBigEndianMachObject) {
+			t.Errorf("magic 0x%x: expected ErrBigEndianMachObject, got %v", magic, err)
+		}
+
+		// universal文件中的大端架构
+		arm64 := testMachObject(true, CpuTypeArm64)
+		arm64.FatArch = &FatArch{CpuType: CpuTypeArm64, Align: 1 << 14}
+		ppc := testMachObject(false, CpuTypePowerPC)
+		ppc.FatArch = &FatArch{CpuType: CpuTypePowerPC, Align: 1 << 12}
+		fat := PackMachObjects([]*MachObjectFile{arm64, ppc})
+		binary.BigEndian.PutUint32(fat[binary.BigEndian.Uint32(fat[FatHeaderSize+FatArchSize+8:]):], magic)
+		if _, err := ReadMachObjects(fat); !errors.Is(err, ErrBigEndianMachObject) {
+			t.Errorf("fat magic 0x%x: expected ErrBigEndianMachObject, got %v", magic, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package mach
 
 import (
+	"bytes"
 	"encoding/binary"
 )
 
@@ -99,6 +100,8 @@ func(s *Section64) GetBytes()[]byte {
 	return buffer
 }
 
+// cmd和cmdsize
+const LoadCommandSize = 8
 type LoadCommand struct {
 	commandType uint32
 	CommandSize uint32
@@ -327,6 +330,34 @@ func NewCommand(buffer []byte) Entity {
 		comm = new(SegmentCommand64)
 	case LC_CodeSignature:
 		comm = new(CodeSignatureCommand)
+	case LC_LoadDynamicLibrary, LC_IDDynamicLibrary, LC_LoadWeakDynamicLibrary, LC_ReexportDynamicLibrary,
+		LC_LazyLoadDynamicLibrary, LC_LoadUpwardDynamicLibrary:
+		comm = new(DylibCommand)
+	case LC_LoadDynamicLinker, LC_IDDynamicLinker:
+		comm = new(DylinkerCommand)
+	case LC_RunPath:
+		comm = new(RunPathCommand)
+	case LC_UUID:
+		comm = new(UUIDCommand)
+	case LC_EncryptionInfo, LC_EncryptionInfo64:
+		comm = new(EncryptionInfoCommand)
+	case LC_VersionMinMacOSX, LC_VersionMinIPhoneOS, LC_VersionMinTvOS, LC_VersionMinWatchOS:
+		comm = new(VersionMinCommand)
+	case LC_BuildVersion:
+		comm = new(BuildVersionCommand)
+	case LC_SourceVersion:
+		comm = new(SourceVersionCommand)
+	case LC_MainEntryPoint:
+		comm = new(EntryPointCommand)
+	case LC_DynamicLinkerInfo, LC_DynamicLinkerInfoOnly:
+		comm = new(DyldInfoCommand)
+	case LC_SymbolTable:
+		comm = new(SymtabCommand)
+	case LC_DynamicSymbolTable:
+		comm = new(DysymtabCommand)
+	case LC_FunctionStarts, LC_DataInCode, LC_SegmentSplitInfo, LC_DylibCodeSignDRs,
+		LC_LinkerOptimizationHint, LC_DynamicLinkerExportsTrie, LC_DynamicLinkerChainedFixups:
+		comm = new(LinkEditDataCommand)
 	default:
 		comm = new(LoadCommand)
 	}
@@ -334,6 +365,100 @@ func NewCommand(buffer []byte) Entity {
 	return comm
 }
 
+// 读取一个load command，buffer从命令开始，长度由cmdsize决定
+// 类型化的命令不能原样写回时(如字符串之后的填充不为0)保留为LoadCommand，保证重新序列化后字节一致
+// 签名依赖的segment和LC_CODE_SIGNATURE解析失败时返回错误
+func ReadCommand(buffer []byte)(Entity, error) {
+	if len(buffer) < LoadCommandSize {
+		return nil, ErrBadCommandSize
+	}
+	size := binary.LittleEndian.Uint32(buffer[4:])
+	if size < LoadCommandSize || uint64(size) > uint64(len(buffer)) {
+		return nil, ErrBadCommandSize
+	}
+	buffer = buffer[:size]
+	command := NewCommand(buffer)
+	switch command.(type) {
+	case *LoadCommand:
+	case *SegmentCommand32, *SegmentCommand64, *CodeSignatureCommand:
+		if !loadCommand(command, buffer) {
+			return nil, ErrBadCommandSize
+		}
+		return command, nil
+	default:
+		if loadCommand(command, buffer) {
+			return command, nil
+		}
+	}
+	command = new(LoadCommand)
+	command.Load(buffer)
+	return command, nil
+}
+
+// 解析类型化的命令，长度不足或者不能原样写回时返回false
+func loadCommand(command Entity, buffer []byte)bool {
+	if uint64(len(buffer)) < commandMinimumSize(command, buffer) {
+		return false
+	}
+	if command.Load(buffer) != len(buffer) || command.Length() != len(buffer) {
+		return false
+	}
+	data := make([]byte, len(buffer))
+	command.WriteBytes(data)
+	return bytes.Equal(data, buffer)
+}
+
+// 类型化命令的Load没有边界检查，解析前buffer至少要有这些字节，包括section和tool等数组
+func commandMinimumSize(command Entity, buffer []byte)uint64 {
+	switch command.(type) {
+	case *SegmentCommand32:
+		if len(buffer) < SegmentCommand32Size {
+			return SegmentCommand32Size
+		}
+		return SegmentCommand32Size + uint64(binary.LittleEndian.Uint32(buffer[48:]))*Section32Size
+	case *SegmentCommand64:
+		if len(buffer) < SegmentCommand64Size {
+			return SegmentCommand64Size
+		}
+		return SegmentCommand64Size + uint64(binary.LittleEndian.Uint32(buffer[64:]))*Section64Size
+	case *BuildVersionCommand:
+		if len(buffer) < BuildVersionCommandSize {
+			return BuildVersionCommandSize
+		}
+		return BuildVersionCommandSize + uint64(binary.LittleEndian.Uint32(buffer[20:]))*8
+	case *EncryptionInfoCommand:
+		if binary.LittleEndian.Uint32(buffer) == LC_EncryptionInfo64 {
+			return EncryptionInfoCommand64Size
+		}
+		return EncryptionInfoCommandSize
+	case *CodeSignatureCommand:
+		return CodeSignatureCommandSize
+	case *DylibCommand:
+		return DylibCommandSize
+	case *DylinkerCommand:
+		return DylinkerCommandSize
+	case *RunPathCommand:
+		return RunPathCommandSize
+	case *UUIDCommand:
+		return UUIDCommandSize
+	case *VersionMinCommand:
+		return VersionMinCommandSize
+	case *SourceVersionCommand:
+		return SourceVersionCommandSize
+	case *EntryPointCommand:
+		return EntryPointCommandSize
+	case *DyldInfoCommand:
+		return DyldInfoCommandSize
+	case *SymtabCommand:
+		return SymtabCommandSize
+	case *DysymtabCommand:
+		return DysymtabCommandSize
+	case *LinkEditDataCommand:
+		return LinkEditDataCommandSize
+	}
+	return LoadCommandSize
+}
+
 var LinkEditSegmentName = []byte{'_','_','L','I','N','K','E','D','I','T', 0}
 func isLinkEditSegmentName(name [16]byte )bool {
 	for i, v := range LinkEditSegmentName {
@@ -344,6 +469,32 @@ func isLinkEditSegmentName(name [16]byte )bool {
 	return true
 }
 
+var TextSegmentName = []byte{'_','_','T','E','X','T', 0}
+func isTextSegmentName(name [16]byte )bool {
+	for i, v := range TextSegmentName {
+		if name[i] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func FindTextSegment(loadCommands[]Entity) Entity {
+	for _, loadCommand := range loadCommands {
+		switch loadCommand := loadCommand.(type) {
+		case *SegmentCommand32:
+			if isTextSegmentName(loadCommand.SegmentName) {
+				return loadCommand
+			}
+		case *SegmentCommand64:
+			if isTextSegmentName(loadCommand.SegmentName) {
+				return loadCommand
+			}
+		}
+	}
+	return nil
+}
+
 func FindLinkEditSegment(loadCommands[]Entity) Entity {
      for _,loadCommand :=range loadCommands{
 		 switch loadCommand:=loadCommand.(type) {
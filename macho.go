@@ -0,0 +1,128 @@
+package appsign
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/pkcs12"
+	"howett.net/plist"
+
+	"github.com/gamebtc/appsign/codesign"
+	"github.com/gamebtc/appsign/mach"
+)
+
+// 签名身份：证书链(Apple根证书和WWDR在前，签名证书在最后)和私钥
+type SigningIdentity struct {
+	CertificateChain []*x509.Certificate
+	PrivateKey       crypto.Signer
+}
+
+// 从.p12文件读取签名证书和私钥，证书链使用CertificateStorePath中的Apple证书
+func LoadSigningIdentity(signCertBytes []byte, certPwd string)(*SigningIdentity, error) {
+	privateKey, signCert, err := pkcs12.Decode(signCertBytes, certPwd)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key")
+	}
+	certificateStore, err := appleCertificateStore(CertificateStorePath)
+	if len(certificateStore) == 0 || err != nil {
+		return nil, errors.New("failed to read certificate store")
+	}
+	return &SigningIdentity{
+		CertificateChain: append(certificateStore, signCert),
+		PrivateKey:       signer,
+	}, nil
+}
+
+// 签名证书
+func(i *SigningIdentity)Certificate()*x509.Certificate {
+	return i.CertificateChain[len(i.CertificateChain)-1]
+}
+
+// 独立的Mach-O文件(如动态库、命令行工具)的签名选项
+type MachOSignOptions struct {
+	// 签名的标识符，为空时使用文件名(不含扩展名)
+	Identifier string
+	// 签名中的权限，为nil时不包含权限
+	Entitlements codesign.EntitlementsFile
+	// 代码签名选项，如CodeDirectory的hash类型
+	codesign.SignOptions
+}
+
+// 解析entitlements的plist文件
+func ParseEntitlementsFromFile(fileName string)(codesign.EntitlementsFile, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	entitlements := make(codesign.EntitlementsFile)
+	if _, err = plist.Unmarshal(data, entitlements); err != nil {
+		return nil, err
+	}
+	return entitlements, nil
+}
+
+// 默认的签名标识符：文件名去掉扩展名，如 libfoo.dylib 为 libfoo
+func DefaultIdentifier(path string)string {
+	name := filepath.Base(path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// 对不在bundle中的Mach-O文件签名，Info.plist和CodeResources对应的槽位为空，签名后覆盖原文件
+func SignMachO(path string, identity *SigningIdentity, options *MachOSignOptions)error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if options == nil {
+		options = new(MachOSignOptions)
+	}
+	if options.Identifier == "" {
+		opts := *options
+		opts.Identifier = DefaultIdentifier(path)
+		options = &opts
+	}
+	signed, err := SignMachOBytes(data, identity, options)
+	if err != nil {
+		return errors.New(path + ": " + err.Error())
+	}
+	mode := os.FileMode(0755)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode()
+	}
+	return ioutil.WriteFile(path, signed, mode)
+}
+
+// 对Mach-O文件的每个架构签名，返回签名后的文件，options.AdHoc时identity可以为nil
+func SignMachOBytes(data []byte, identity *SigningIdentity, options *MachOSignOptions)([]byte, error) {
+	if options == nil || options.Identifier == "" {
+		return nil, errors.New("missing code signing identifier")
+	}
+	var certChain []*x509.Certificate
+	var privateKey crypto.Signer
+	if identity != nil {
+		certChain, privateKey = identity.CertificateChain, identity.PrivateKey
+	} else if !options.AdHoc {
+		return nil, errors.New("missing signing identity")
+	}
+	files, err := mach.ReadMachObjects(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		_, err := codesign.ResignExecutable(file, options.Identifier, certChain, privateKey,
+			nil, nil, options.Entitlements, &options.SignOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mach.PackMachObjects(files), nil
+}
@@ -104,11 +104,9 @@ func (m *MobileProvisionFile)MatchingCertificate(certificate *x509.Certificate)b
 }
 
 func(m* MobileProvisionFile)BundleIdentifier()string {
-	teamID, ok1 := m.Entitlements["com.apple.developer.team-identifier"]
-	applicationID, ok2 := m.Entitlements["application-identifier"]
+	teamID, ok1 := m.Entitlements["com.apple.developer.team-identifier"].(string)
+	applicationID, ok2 := m.Entitlements["application-identifier"].(string)
 	if ok1 && ok2 {
-		teamID := teamID.(string)
-		applicationID := applicationID.(string)
 		if strings.Index(applicationID, teamID) == 0 && len(applicationID) > len(teamID) {
 			return applicationID[len(teamID)+1:]
 		}
@@ -116,6 +114,28 @@ func(m* MobileProvisionFile)BundleIdentifier()string {
 	return ""
 }
 
+// 描述文件中的bundle id可以以*结尾
+func(m* MobileProvisionFile)MatchBundleIdentifier(bundleId string)bool {
+	pattern := m.BundleIdentifier()
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(bundleId, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == bundleId
+}
+
+// 签名后使用的bundle id，通配符描述文件保留原有的bundle id
+// 描述文件缺少application-identifier或team-identifier时返回错误
+func(m* MobileProvisionFile)ApplyBundleIdentifier(bundleId string)(string, error) {
+	pattern := m.BundleIdentifier()
+	if pattern == "" {
+		return "", errors.New("mobile provision has no valid application-identifier or team-identifier: " + m.Name)
+	}
+	if !strings.HasSuffix(pattern, "*") {
+		return pattern, nil
+	}
+	return bundleId, nil
+}
+
 func EqualOid(a []byte, b[]byte) bool{
 	if len(a) != len(b) {
 		return false
@@ -0,0 +1,40 @@
+package appsign
+
+import "github.com/gamebtc/appsign/codesign"
+
+// 重签名选项
+type ResignOptions struct {
+	// 主bundle的描述文件，为空时使用IPA中的embedded.mobileprovision
+	MobileProvision *MobileProvisionFile
+	// 嵌套的扩展(.appex)和Watch应用的描述文件
+	// key为原始的bundle id或相对于.app目录的路径(如PlugIns/Share.appex)
+	// 不为nil时，每个嵌套的扩展都必须有对应的描述文件
+	// 为nil时嵌套的扩展保留原有的描述文件，原有的描述文件不属于签名证书的team时返回错误
+	BundleProvisions map[string]*MobileProvisionFile
+	// 包含FairPlay加密的Mach-O时仍然签名，默认返回EncryptedError
+	AllowEncrypted bool
+	// 警告信息的输出，如AllowEncrypted时加密的文件，为nil时忽略
+	Warn func(message string)
+	// 代码签名选项，如CodeDirectory的hash类型
+	codesign.SignOptions
+}
+
+func(o *ResignOptions)warn(message string) {
+	if o.Warn != nil {
+		o.Warn(message)
+	}
+}
+
+// 所有需要和签名证书匹配的描述文件
+func(o *ResignOptions)mobileProvisions()[]*MobileProvisionFile {
+	var provisions []*MobileProvisionFile
+	if o.MobileProvision != nil {
+		provisions = append(provisions, o.MobileProvision)
+	}
+	for _, provision := range o.BundleProvisions {
+		if provision != nil {
+			provisions = append(provisions, provision)
+		}
+	}
+	return provisions
+}
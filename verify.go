@@ -0,0 +1,280 @@
+package appsign
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gamebtc/appsign/codesign"
+	"github.com/gamebtc/appsign/mach"
+)
+
+func readCertificateFile(fileName string)([]*x509.Certificate, error) {
+	bin, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificates(bin)
+}
+
+// 校验IPA中主bundle及所有嵌套代码的签名
+// 证书链校验使用CertificateStorePath目录下的AppleIncRootCertificate.cer和AppleWWDRCA.cer
+func VerifyIpa(f *IpaFile)*codesign.VerifyReport {
+	report := new(codesign.VerifyReport)
+	options := new(codesign.VerifyOptions)
+	if roots, err := readCertificateFile(CertificateStorePath + "AppleIncRootCertificate.cer"); err != nil {
+		report.Fail("", "certificate store: %v", err)
+	} else {
+		options.Roots = x509.NewCertPool()
+		for _, root := range roots {
+			options.Roots.AddCert(root)
+		}
+		// 证书中通常会附带WWDR证书，没有时从证书目录读取
+		if intermediates, err := readCertificateFile(CertificateStorePath + "AppleWWDRCA.cer"); err == nil {
+			options.Intermediates = intermediates
+		}
+	}
+	f.verifyBundle(report, f.GetBundle(), options)
+	return report
+}
+
+// 返回bundle可执行文件所有架构的cdhash
+func(f *IpaFile)verifyBundle(report *codesign.VerifyReport, b *Bundle, options *codesign.VerifyOptions)[][]byte {
+	nestedHashes := make(map[string][][]byte)
+	for _, nested := range b.Bundles {
+		nestedHashes[nested.RelativePath()] = f.verifyBundle(report, nested, options)
+	}
+	for _, lib := range b.Libraries {
+		name := lib[strings.LastIndex(lib, ZipDirectorySeparator)+1:]
+		libOptions := *options
+		libOptions.CheckResources = true
+		nestedHashes[lib[len(b.Path):]] = f.verifyMachO(report, lib, strings.TrimSuffix(name, dynamicLibraryExtension), &libOptions)
+	}
+
+	infoEntry := f.getEntry(b.Path + InfoFileName)
+	if infoEntry == nil {
+		report.Fail(b.Path+InfoFileName, "file is missing")
+		return nil
+	}
+	infoFile, err := ParseInfo(infoEntry.Data)
+	if err != nil {
+		report.Fail(b.Path+InfoFileName, "%v", err)
+		return nil
+	}
+	bundleId := infoFile.BundleId()
+	executableName := infoFile.ExecutableName()
+
+	var codeResBytes []byte
+	if entry := f.getEntry(b.Path + CodeResourcesFilePath); entry == nil {
+		report.Fail(b.Path+CodeResourcesFilePath, "file is missing, bundle resources are not sealed")
+	} else if codeRes, err := codesign.ParseCodeResources(entry.Data); err != nil {
+		report.Fail(b.Path+CodeResourcesFilePath, "%v", err)
+	} else {
+		codeResBytes = entry.Data
+		f.verifyCodeResources(report, b, codeRes, executableName, nestedHashes)
+	}
+
+	if entry := f.getEntry(b.Path + MobileProvisionFileName); entry != nil {
+		f.verifyMobileProvision(report, b.Path+MobileProvisionFileName, entry.Data, bundleId)
+	} else if b.Parent == nil || b.IsApplication() {
+		report.Fail(b.Path+MobileProvisionFileName, "file is missing")
+	}
+
+	exeOptions := *options
+	exeOptions.CheckResources = true
+	exeOptions.InfoFileBytes = infoEntry.Data
+	exeOptions.CodeResourcesBytes = codeResBytes
+	return f.verifyMachO(report, b.Path+executableName, bundleId, &exeOptions)
+}
+
+// 校验Mach-O每个架构的签名，返回所有CodeDirectory的cdhash
+func(f *IpaFile)verifyMachO(report *codesign.VerifyReport, path, ident string, options *codesign.VerifyOptions)[][]byte {
+	entry := f.getEntry(path)
+	if entry == nil {
+		report.Fail(path, "file is missing")
+		return nil
+	}
+	files, err := mach.ReadMachObjects(entry.Data)
+	if err != nil {
+		report.Fail(path, err.Error())
+		return nil
+	}
+	var cdHashes [][]byte
+	for i, file := range files {
+		name := path
+		if len(files) > 1 {
+			name = fmt.Sprintf("%s (slice %d)", path, i)
+		}
+		report.Merge(name, codesign.VerifyExecutableWithOptions(file, options))
+		signature, err := codesign.ParseEmbeddedSignature(file)
+		if err != nil {
+			continue
+		}
+		if signature.Identifier() != ident {
+			report.Fail(name, "signed with identifier %q, expected %q", signature.Identifier(), ident)
+		}
+		cdHashes = append(cdHashes, signature.CDHashes()...)
+	}
+	return cdHashes
+}
+
+func(f *IpaFile)verifyMobileProvision(report *codesign.VerifyReport, path string, data []byte, bundleId string) {
+	mobileProvision, err := ParseMobileProvision(data)
+	if err != nil {
+		report.Fail(path, "%v", err)
+		return
+	}
+	if mobileProvision.ExpirationDate.Before(time.Now()) {
+		report.Fail(path, "provisioning profile %q expired at %s", mobileProvision.Name, mobileProvision.ExpirationDate.Format(time.RFC3339))
+	}
+	if !mobileProvision.MatchBundleIdentifier(bundleId) {
+		report.Fail(path, "bundle identifier %q is not allowed by provisioning profile (%q)", bundleId, mobileProvision.BundleIdentifier())
+	}
+}
+
+// 校验CodeResources中的每个文件，以及bundle中没有被记录的文件
+func(f *IpaFile)verifyCodeResources(report *codesign.VerifyReport, b *Bundle, codeRes *codesign.CodeResourcesFile,
+	executableName string, nestedHashes map[string][][]byte) {
+
+	files := codeRes.Files()
+	for _, name := range sortedKeys(files) {
+		node := files[name]
+		entry := f.getEntry(b.Path + name)
+		hash, optional := resourceHash(node, "hash")
+		if entry == nil || entry.IsDir {
+			if !optional {
+				report.Fail(b.Path+name, "file is missing")
+			}
+			continue
+		}
+		if entry.IsSymlink() {
+			continue
+		}
+		sha1Hash := sha1.Sum(entry.Data)
+		if !bytes.Equal(hash, sha1Hash[:]) {
+			report.Fail(b.Path+name, "file was modified (files)")
+		}
+	}
+
+	files2 := codeRes.Files2()
+	for _, name := range sortedKeys(files2) {
+		node := files2[name]
+		path := b.Path + name
+		if dict, ok := node.(map[string]interface{}); ok {
+			if cdHash, ok := dict["cdhash"].([]byte); ok {
+				hashes, ok := nestedHashes[name]
+				if !ok {
+					report.Fail(path, "nested code is missing")
+				} else if !containsHash(hashes, cdHash) {
+					report.Fail(path, "nested code cdhash does not match")
+				}
+				continue
+			}
+			if target, ok := dict["symlink"].(string); ok {
+				entry := f.getEntry(path)
+				if entry == nil || !entry.IsSymlink() || string(entry.Data) != target {
+					report.Fail(path, "symlink to %q is missing or changed", target)
+				}
+				continue
+			}
+		}
+		entry := f.getEntry(path)
+		_, optional := resourceHash(node, "hash")
+		if entry == nil || entry.IsDir {
+			if !optional {
+				report.Fail(path, "file is missing")
+			}
+			continue
+		}
+		if hash2, _ := resourceHash(node, "hash2"); hash2 != nil {
+			sha256Hash := sha256.Sum256(entry.Data)
+			if !bytes.Equal(hash2, sha256Hash[:]) {
+				report.Fail(path, "file was modified")
+			}
+		} else if hash, _ := resourceHash(node, "hash"); hash != nil {
+			sha1Hash := sha1.Sum(entry.Data)
+			if !bytes.Equal(hash, sha1Hash[:]) {
+				report.Fail(path, "file was modified")
+			}
+		}
+	}
+
+	// 签名后添加的文件
+	rules := codeRes.Rules2()
+	for _, nested := range b.Bundles {
+		if _, ok := files2[nested.RelativePath()]; !ok {
+			report.Fail(nested.Path, "nested code is not sealed")
+		}
+	}
+	for _, lib := range b.Libraries {
+		if _, ok := files2[lib[len(b.Path):]]; !ok {
+			report.Fail(lib, "nested code is not sealed")
+		}
+	}
+	for _, entry := range f.entries {
+		if entry.IsDir || !strings.HasPrefix(entry.Name, b.Path) {
+			continue
+		}
+		name := entry.Name[len(b.Path):]
+		if name == executableName || strings.HasPrefix(name, codesign.CodeSignatureDirectory) {
+			continue
+		}
+		if _, ok := nestedHashes[name]; ok || isInNestedBundle(b, entry.Name) {
+			continue
+		}
+		if _, ok := files2[name]; ok {
+			continue
+		}
+		if rule := codesign.MatchResourceRule(rules, name); rule != nil && !rule.Omit && !rule.Nested {
+			report.Fail(entry.Name, "file was added after signing")
+		}
+	}
+}
+
+func isInNestedBundle(b *Bundle, path string)bool {
+	for _, nested := range b.Bundles {
+		if strings.HasPrefix(path, nested.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// CodeResources中文件的hash，node为data或包含hash和optional的dict
+func resourceHash(node interface{}, key string)([]byte, bool) {
+	switch node := node.(type) {
+	case []byte:
+		if key == "hash" {
+			return node, false
+		}
+	case map[string]interface{}:
+		hash, _ := node[key].([]byte)
+		optional, _ := node["optional"].(bool)
+		return hash, optional
+	}
+	return nil, false
+}
+
+func sortedKeys(m map[string]interface{})[]string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsHash(hashes [][]byte, hash []byte)bool {
+	for _, h := range hashes {
+		if bytes.Equal(h, hash) {
+			return true
+		}
+	}
+	return false
+}